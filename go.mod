@@ -1,19 +1,48 @@
 module DiscordMBM
 
-go 1.19
+go 1.21
+
+require (
+	github.com/andersfylling/disgord v0.35.1
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/gorcon/telnet v1.2.2
+	github.com/prometheus/client_golang v1.20.5
+	github.com/rumblefrog/go-a2s v1.0.1
+	github.com/sandertv/gophertunnel v1.24.11
+	github.com/teivah/broadcast v0.1.0
+	github.com/wcharczuk/go-chart/v2 v2.1.2
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.30.2
+)
 
 require (
-	github.com/andersfylling/disgord v0.35.1 // indirect
 	github.com/andersfylling/snowflake/v5 v5.0.1 // indirect
-	github.com/gorcon/telnet v1.2.2 // indirect
-	github.com/klauspost/compress v1.15.1 // indirect
-	github.com/rumblefrog/go-a2s v1.0.1 // indirect
-	github.com/sandertv/gophertunnel v1.24.11 // indirect
-	github.com/teivah/broadcast v0.1.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	go.uber.org/atomic v1.9.0 // indirect
-	golang.org/x/crypto v0.0.0-20220411220226-7b82a4e95df4 // indirect
-	golang.org/x/net v0.0.0-20220418201149-a630d4f3e7a2 // indirect
-	golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/image v0.18.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.52.1 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
 	nhooyr.io/websocket v1.8.7 // indirect
 )
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"DiscordMBM/pkg/chart"
+	"DiscordMBM/pkg/core"
+	"DiscordMBM/pkg/history"
+	"DiscordMBM/pkg/metrics"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// startHTTP starts embedded http server and stops it when ctx is done, listen errors are returned immediately
+// History endpoints are available when store is not nil, charts are drawn from charts source.
+func startHTTP(ctx context.Context, addr string, supervisor *core.Supervisor, store *history.Store, charts chart.Source, logger *slog.Logger) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/api/servers", func(w http.ResponseWriter, r *http.Request) {
+		if !allowRead(w, r) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, supervisor.Reports())
+	})
+	mux.HandleFunc("/api/servers/", func(w http.ResponseWriter, r *http.Request) {
+		if !allowRead(w, r) {
+			return
+		}
+
+		key, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/servers/"), "/")
+
+		report, ok := supervisor.Report(key)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, apiError{Error: "server not found"})
+			return
+		}
+
+		switch resource {
+		case "":
+			writeJSON(w, http.StatusOK, report)
+		case "history":
+			serveHistory(w, r, store, key)
+		case "chart":
+			serveChart(w, r, charts, key, report.Name)
+		default:
+			writeJSON(w, http.StatusNotFound, apiError{Error: "not found"})
+		}
+	})
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server stopped", "error", err)
+		}
+	}()
+
+	logger.Info("HTTP server started", "addr", listener.Addr().String())
+
+	return nil
+}
+
+type historyResponse struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Peak    *history.Sample  `json:"peak"`
+	Samples []history.Sample `json:"samples"`
+}
+
+// serveHistory returns samples and peak of the server, period query parameter is a duration back from now, 24h by default
+func serveHistory(w http.ResponseWriter, r *http.Request, store *history.Store, key string) {
+	if store == nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "history is disabled"})
+		return
+	}
+
+	period := 24 * time.Hour
+	if value := r.URL.Query().Get("period"); value != "" {
+		var err error
+
+		period, err = time.ParseDuration(value)
+		if err != nil || period <= 0 {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "period must be a positive duration, e.g. 24h"})
+			return
+		}
+	}
+
+	to := time.Now()
+	response := historyResponse{From: to.Add(-period), To: to}
+
+	var err error
+
+	response.Samples, err = store.Samples(r.Context(), key, response.From, to)
+	if err == nil {
+		response.Peak, err = store.Peak(r.Context(), key, response.From, to)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// serveChart returns PNG players chart of the server, period query parameter is 24h, 7d or 30d, 24h by default
+func serveChart(w http.ResponseWriter, r *http.Request, charts chart.Source, key string, name string) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+
+	if _, ok := chart.Periods[period]; !ok {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "period must be one of 24h, 7d, 30d"})
+		return
+	}
+
+	var png bytes.Buffer
+
+	err := chart.RenderPeriod(r.Context(), &png, charts, key, name, period)
+	if errors.Is(err, chart.ErrNoData) {
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(png.Bytes())
+}
+
+// allowRead rejects requests which are not GET or HEAD
+func allowRead(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+
+	w.Header().Set("Allow", "GET, HEAD")
+	writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -1,101 +1,192 @@
 package main
 
 import (
+	"DiscordMBM/pkg/chart"
 	"DiscordMBM/pkg/core"
-	"DiscordMBM/pkg/minecraft"
-	"DiscordMBM/pkg/scpsl"
-	"DiscordMBM/pkg/sevend2d"
-	"DiscordMBM/pkg/source"
-	"DiscordMBM/pkg/ut3"
+	"DiscordMBM/pkg/history"
+	_ "DiscordMBM/pkg/minecraft"
+	_ "DiscordMBM/pkg/scpsl"
+	_ "DiscordMBM/pkg/sevend2d"
+	_ "DiscordMBM/pkg/source"
+	_ "DiscordMBM/pkg/ut3"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
-type Monitors struct {
-	SCPSL    *scpsl.Monitor
-	Source   *source.Monitor
-	UT3      *ut3.Monitor
-	MC       *minecraft.Monitor
-	SevenD2D *sevend2d.Monitor
-}
+const usage = `Usage:
+  discordMBM [run] [flags]     start monitoring bots, see discordMBM run -h
+  discordMBM validate [flags]  check config without starting bots
+  discordMBM query [flags]     query a single server once, see discordMBM query -h
+`
 
 func main() {
-	config, err := core.ParseConfig("config.yml")
+	args := os.Args[1:]
+
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "run":
+		run(args)
+	case "validate":
+		os.Exit(validate(args))
+	case "query":
+		os.Exit(query(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+func run(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := flags.String("config", envString("DISCORDMBM_CONFIG", "config.yml"),
+		"path to config file, env DISCORDMBM_CONFIG")
+	logLevel := flags.String("log-level", envString("DISCORDMBM_LOG_LEVEL", ""),
+		"log level: debug, info, warn or error, overrides log.level config option, env DISCORDMBM_LOG_LEVEL")
+	logFormat := flags.String("log-format", envString("DISCORDMBM_LOG_FORMAT", ""),
+		"log format: text or json, overrides log.format config option, env DISCORDMBM_LOG_FORMAT")
+	dryRun := flags.Bool("dry-run", envBool("DISCORDMBM_DRY_RUN"),
+		"query servers and log bot presences without connecting to discord, env DISCORDMBM_DRY_RUN")
+	_ = flags.Parse(args)
+
+	// command line options are applied on every config reload
+	loadConfig := func() (*core.Config, error) {
+		config, err := core.ParseConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if *logLevel != "" {
+			config.Log.Level = *logLevel
+		}
+		if *logFormat != "" {
+			config.Log.Format = *logFormat
+		}
+
+		config.DryRun = *dryRun
+
+		return config, nil
+	}
+
+	config, err := loadConfig()
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// log settings are not reloaded, logger is built once for the whole run
+	logger, logFile, err := core.NewLogger(config)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer logFile.Close()
+
+	slog.SetDefault(logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
 
+	supervisor := core.NewSupervisor(ctx, logger)
+
+	// state file, history and http settings are not reloaded too
+	stateFile, err := core.OpenStateFile(config.GetStateFile())
 	if err != nil {
 		log.Fatalln(err)
 	}
+	supervisor.SetStateFile(stateFile)
+
+	var store *history.Store
+	var charts chart.Source
 
-	var monitors Monitors
+	if config.History.Path != "" {
+		store, err = history.Open(config.History, logger)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer store.Close()
+
+		go store.Run(ctx)
+		supervisor.AddRecorder(store)
+		charts = store
+	} else {
+		// charts are drawn from recent samples kept in memory when history is disabled
+		buffer := chart.NewBuffer()
+		supervisor.AddRecorder(buffer)
+		charts = buffer
+	}
+
+	supervisor.SetChart(func(ctx context.Context, w io.Writer, key string, title string, period string) error {
+		return chart.RenderPeriod(ctx, w, charts, key, title, period)
+	})
+
+	if config.HTTP.Listen != "" {
+		err = startHTTP(ctx, config.HTTP.Listen, supervisor, store, charts, logger)
+		if err != nil {
+			log.Fatalln(fmt.Sprintf("failed to start http server: %s", err.Error()))
+		}
+	}
+
+	supervisor.Apply(config)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	changes, err := core.WatchConfig(ctx, *configPath, logger)
+	if err != nil {
+		logger.Warn("Failed to watch config changes, use SIGHUP to reload it", "error", err)
+	}
 
-	for _, server := range config.Servers {
-		if !server.Enabled {
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
 			continue
+		case <-reload:
+		case <-changes:
 		}
 
-		switch server.Game {
-		case "scpsl":
-			if monitors.SCPSL == nil {
-				monitors.SCPSL, err = scpsl.CreateMonitor(config)
-
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
-
-			log.Println(fmt.Sprintf("Running %s server", server.Name))
-			go monitors.SCPSL.Run(server)
-		case "source":
-			if monitors.Source == nil {
-				monitors.Source, err = source.CreateMonitor(config)
-
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
-
-			log.Println(fmt.Sprintf("Running %s server", server.Name))
-			go monitors.Source.Run(server)
-		case "mc":
-			if monitors.MC == nil {
-				monitors.MC, err = minecraft.CreateMonitor(config)
-
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
-
-			log.Println(fmt.Sprintf("Running %s server", server.Name))
-			go monitors.MC.Run(server)
-		case "7d2d":
-			if monitors.SevenD2D == nil {
-				monitors.SevenD2D, err = sevend2d.CreateMonitor(config)
-
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
-
-			log.Println(fmt.Sprintf("Running %s server", server.Name))
-			go monitors.SevenD2D.Run(server)
-		case "ut3":
-			if monitors.UT3 == nil {
-				monitors.UT3, err = ut3.CreateMonitor(config)
-
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
-
-			log.Println(fmt.Sprintf("Running %s server", server.Name))
-			go monitors.UT3.Run(server)
+		logger.Info("Reloading config")
+
+		newConfig, err := loadConfig()
+		if err != nil {
+			logger.Error("Config is not reloaded, running servers are left as is", "error", err)
+			continue
 		}
+
+		supervisor.Apply(newConfig)
+	}
+
+	logger.Info("Shutting down")
+
+	if !supervisor.Wait(config.GetShutdownTimeout()) {
+		logger.Warn("Shutdown timeout exceeded, exiting anyway")
 	}
+}
+
+// envString returns environment variable value or fallback if it is not set
+func envString(name string, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+
+	return fallback
+}
+
+func envBool(name string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(name))
 
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGTERM, syscall.SIGINT)
-	<-sc
+	return value
 }
@@ -0,0 +1,122 @@
+package chart
+
+import (
+	"DiscordMBM/pkg/core"
+	"DiscordMBM/pkg/history"
+	"context"
+	"sync"
+	"time"
+)
+
+// bucketWidth is a time covered by a single buffer slot, slot keeps peak players of its time
+const bucketWidth = 10 * time.Minute
+
+// bufferLength is a number of slots covering the longest chart period
+const bufferLength = int(MaxPeriod / bucketWidth)
+
+// Buffer keeps recent samples of every server in memory, it implements core.Recorder and Source.
+// Samples are merged into 10 minute peaks and averages, so memory used by server is bounded.
+type Buffer struct {
+	mu    sync.RWMutex
+	rings map[string]*ring
+}
+
+type ring struct {
+	samples []history.Sample
+	// counts are numbers of samples merged into slots, they give average players of slots
+	counts []int
+	// next is an index of the slot written after buffer is full
+	next int
+}
+
+func NewBuffer() *Buffer {
+	return &Buffer{rings: make(map[string]*ring)}
+}
+
+func (b *Buffer) Record(key string, at time.Time, status *core.ServerStatus) {
+	sample := history.Sample{
+		Time:       at.Truncate(bucketWidth),
+		Online:     status.Online,
+		Players:    status.Players,
+		AvgPlayers: float64(status.Players),
+		MaxPlayers: status.MaxPlayers,
+		Map:        status.Map,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.rings[key]
+	if !ok {
+		r = &ring{samples: make([]history.Sample, 0, bufferLength), counts: make([]int, 0, bufferLength)}
+		b.rings[key] = r
+	}
+
+	r.add(sample)
+}
+
+// Samples returns buffered samples of the server in [from, to) ordered by time
+func (b *Buffer) Samples(ctx context.Context, key string, from time.Time, to time.Time) ([]history.Sample, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	samples := make([]history.Sample, 0)
+
+	r, ok := b.rings[key]
+	if !ok {
+		return samples, nil
+	}
+
+	for _, sample := range r.ordered() {
+		if !sample.Time.Before(from) && sample.Time.Before(to) {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples, nil
+}
+
+// add merges sample into the latest slot of the same time or writes it to a new slot
+func (r *ring) add(sample history.Sample) {
+	if len(r.samples) > 0 {
+		index := r.lastIndex()
+		last := &r.samples[index]
+
+		if last.Time.Equal(sample.Time) {
+			count := &r.counts[index]
+			last.AvgPlayers = (last.AvgPlayers*float64(*count) + sample.AvgPlayers) / float64(*count+1)
+			*count++
+
+			last.Online = last.Online || sample.Online
+			last.Players = max(last.Players, sample.Players)
+			last.MaxPlayers = max(last.MaxPlayers, sample.MaxPlayers)
+			if sample.Map != "" {
+				last.Map = sample.Map
+			}
+
+			return
+		}
+	}
+
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, sample)
+		r.counts = append(r.counts, 1)
+		return
+	}
+
+	r.samples[r.next] = sample
+	r.counts[r.next] = 1
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+func (r *ring) lastIndex() int {
+	if len(r.samples) < cap(r.samples) {
+		return len(r.samples) - 1
+	}
+
+	return (r.next - 1 + len(r.samples)) % len(r.samples)
+}
+
+func (r *ring) ordered() []history.Sample {
+	return append(r.samples[r.next:len(r.samples):len(r.samples)], r.samples[:r.next]...)
+}
@@ -0,0 +1,64 @@
+package chart
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBufferWraparound(t *testing.T) {
+	buffer := NewBuffer()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// two extra slots overwrite the oldest ones
+	for i := 0; i < bufferLength+2; i++ {
+		buffer.Record("a", start.Add(time.Duration(i)*bucketWidth), &core.ServerStatus{Online: true, Players: i})
+	}
+
+	samples, err := buffer.Samples(context.Background(), "a", start, start.Add(MaxPeriod+time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != bufferLength {
+		t.Fatalf("Samples() returned %d samples, want %d", len(samples), bufferLength)
+	}
+
+	for i, sample := range samples {
+		if want := i + 2; sample.Players != want {
+			t.Fatalf("sample %d players = %d, want %d", i, sample.Players, want)
+		}
+		if i > 0 && !sample.Time.After(samples[i-1].Time) {
+			t.Fatalf("sample %d time %v is not after %v", i, sample.Time, samples[i-1].Time)
+		}
+	}
+}
+
+func TestBufferMergesSlot(t *testing.T) {
+	buffer := NewBuffer()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// slot after wraparound is merged too
+	for i := 0; i < bufferLength+1; i++ {
+		buffer.Record("a", start.Add(time.Duration(i)*bucketWidth), &core.ServerStatus{Online: true, Players: 1})
+	}
+
+	last := start.Add(time.Duration(bufferLength) * bucketWidth)
+	buffer.Record("a", last.Add(time.Minute), &core.ServerStatus{Online: true, Players: 7, MaxPlayers: 10, Map: "de_dust2"})
+	buffer.Record("a", last.Add(2*time.Minute), &core.ServerStatus{Online: false})
+
+	samples, _ := buffer.Samples(context.Background(), "a", start, last.Add(time.Hour))
+	if len(samples) != bufferLength {
+		t.Fatalf("Samples() returned %d samples, want %d", len(samples), bufferLength)
+	}
+
+	got := samples[len(samples)-1]
+	if !got.Time.Equal(last) || !got.Online || got.Players != 7 || got.MaxPlayers != 10 || got.Map != "de_dust2" {
+		t.Errorf("merged slot = %+v, want peak of slot at %v", got, last)
+	}
+
+	if want := (1.0 + 7 + 0) / 3; got.AvgPlayers != want {
+		t.Errorf("merged slot average = %v, want %v", got.AvgPlayers, want)
+	}
+}
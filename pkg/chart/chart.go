@@ -0,0 +1,144 @@
+package chart
+
+import (
+	"DiscordMBM/pkg/history"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	"io"
+	"math"
+	"time"
+)
+
+// MaxPeriod is the longest chart period
+const MaxPeriod = 30 * 24 * time.Hour
+
+// ErrNoData is returned when there are not enough samples to draw a chart
+var ErrNoData = errors.New("not enough player count samples for chart yet")
+
+// Periods are chart periods available to users
+var Periods = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": MaxPeriod,
+}
+
+// Source provides samples of a server, implemented by Buffer and history store
+type Source interface {
+	Samples(ctx context.Context, key string, from time.Time, to time.Time) ([]history.Sample, error)
+}
+
+// RenderPeriod draws players chart of the server for the period ending now as PNG
+func RenderPeriod(ctx context.Context, w io.Writer, source Source, key string, title string, period string) error {
+	duration, ok := Periods[period]
+	if !ok {
+		return errors.New(fmt.Sprintf("unknown chart period %q, available: 24h, 7d, 30d", period))
+	}
+
+	to := time.Now()
+	from := to.Add(-duration)
+
+	samples, err := source.Samples(ctx, key, from, to)
+	if err != nil {
+		return err
+	}
+
+	return Render(w, fmt.Sprintf("%s, last %s", title, period), samples, from, to)
+}
+
+// Render draws players and max players of samples as PNG line chart, offline samples are drawn as zero players.
+// Average players are drawn when samples are merged peaks, e.g. hourly history.
+func Render(w io.Writer, title string, samples []history.Sample, from time.Time, to time.Time) error {
+	if len(samples) < 2 {
+		return ErrNoData
+	}
+
+	times := make([]time.Time, len(samples))
+	players := make([]float64, len(samples))
+	avgPlayers := make([]float64, len(samples))
+	maxPlayers := make([]float64, len(samples))
+	averaged := false
+	top := 1.0
+
+	for i, sample := range samples {
+		times[i] = sample.Time
+		if sample.Online {
+			players[i] = float64(sample.Players)
+			avgPlayers[i] = sample.AvgPlayers
+			maxPlayers[i] = float64(sample.MaxPlayers)
+		}
+
+		averaged = averaged || avgPlayers[i] != players[i]
+
+		top = max(top, players[i], maxPlayers[i])
+	}
+
+	// player counts are whole numbers, so ticks are too
+	step := math.Ceil(top / 5)
+	top = step * math.Ceil(top/step)
+
+	ticks := make([]chart.Tick, 0, 6)
+	for value := 0.0; value <= top; value += step {
+		ticks = append(ticks, chart.Tick{Value: value, Label: fmt.Sprintf("%.0f", value)})
+	}
+
+	timeFormat := "Jan 02"
+	if to.Sub(from) <= 24*time.Hour {
+		timeFormat = "15:04"
+	}
+
+	graph := chart.Chart{
+		Title:  title,
+		Width:  800,
+		Height: 300,
+		Background: chart.Style{
+			Padding: chart.Box{Top: 40, Left: 10, Right: 10, Bottom: 10},
+		},
+		XAxis: chart.XAxis{
+			Range:          &chart.ContinuousRange{Min: chart.TimeToFloat64(from), Max: chart.TimeToFloat64(to)},
+			ValueFormatter: chart.TimeValueFormatterWithFormat(timeFormat),
+		},
+		YAxis: chart.YAxis{
+			Range: &chart.ContinuousRange{Min: 0, Max: top},
+			Ticks: ticks,
+		},
+		Series: []chart.Series{
+			chart.TimeSeries{
+				Name: "Max players",
+				Style: chart.Style{
+					StrokeColor:     drawing.ColorFromHex("9e9e9e"),
+					StrokeDashArray: []float64{5, 5},
+				},
+				XValues: times,
+				YValues: maxPlayers,
+			},
+			chart.TimeSeries{
+				Name: "Players",
+				Style: chart.Style{
+					StrokeColor: drawing.ColorFromHex("5865f2"),
+					StrokeWidth: 2,
+					FillColor:   drawing.ColorFromHex("5865f2").WithAlpha(64),
+				},
+				XValues: times,
+				YValues: players,
+			},
+		},
+	}
+
+	if averaged {
+		graph.Series = append(graph.Series, chart.TimeSeries{
+			Name: "Average players",
+			Style: chart.Style{
+				StrokeColor: drawing.ColorFromHex("faa61a"),
+				StrokeWidth: 2,
+			},
+			XValues: times,
+			YValues: avgPlayers,
+		})
+	}
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+
+	return graph.Render(chart.PNG, w)
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"time"
+)
+
+// Alert events of server state changes
+const (
+	AlertDown  = "down"
+	AlertUp    = "up"
+	AlertFull  = "full"
+	AlertEmpty = "empty"
+)
+
+var alertEvents = []string{AlertDown, AlertUp, AlertFull, AlertEmpty}
+
+// DefaultAlertCooldown is a minimal time between alerts of the same event of a server
+const DefaultAlertCooldown = 5 * time.Minute
+
+// Alert is a server state change worth posting
+type Alert struct {
+	Event  string
+	Status *ServerStatus
+	// LastError is a query error of down alert
+	LastError error
+	// Downtime is a time server was offline, set on up alert
+	Downtime time.Duration
+}
+
+// AlertTracker detects state changes of a single server from its statuses, zero value is ready to use.
+// The first status only sets initial state, so restarts don't repeat alerts.
+type AlertTracker struct {
+	known  bool
+	online bool
+	full   bool
+	empty  bool
+	// downSince is the latest time server was seen online before it went down
+	downSince time.Time
+	// downSkipped is set when down alert was not posted because of cooldown, so recovery isn't posted too
+	downSkipped bool
+	sent        map[string]time.Time
+}
+
+// Update returns alerts of state change to status, lastErr is the query error of status and
+// lastSuccess is the latest time server was online
+func (t *AlertTracker) Update(config AlertsConfig, status *ServerStatus, lastErr error, lastSuccess time.Time) []Alert {
+	now := time.Now()
+
+	online := status != nil && status.Online
+	full := online && status.MaxPlayers > 0 && status.Players >= status.MaxPlayers
+	empty := online && status.Players == 0
+
+	if !t.known {
+		t.known, t.online, t.full, t.empty = true, online, full, empty
+		t.downSince = now
+
+		return nil
+	}
+
+	var alerts []Alert
+
+	switch {
+	case t.online && !online:
+		t.downSince = lastSuccess
+		if t.downSince.IsZero() {
+			t.downSince = now
+		}
+
+		alert := Alert{Event: AlertDown, Status: status, LastError: lastErr}
+		if t.allow(config, alert.Event, now) {
+			alerts = append(alerts, alert)
+		}
+		t.downSkipped = config.Enabled(AlertDown) && len(alerts) == 0
+	case !t.online && online:
+		alert := Alert{Event: AlertUp, Status: status, Downtime: now.Sub(t.downSince)}
+		if !t.downSkipped && t.allow(config, alert.Event, now) {
+			alerts = append(alerts, alert)
+		}
+		t.downSkipped = false
+	}
+
+	if full && !t.full && t.allow(config, AlertFull, now) {
+		alerts = append(alerts, Alert{Event: AlertFull, Status: status})
+	}
+
+	// server which went online without players is reported by up alert
+	if empty && !t.empty && t.online && t.allow(config, AlertEmpty, now) {
+		alerts = append(alerts, Alert{Event: AlertEmpty, Status: status})
+	}
+
+	t.online, t.full, t.empty = online, full, empty
+
+	return alerts
+}
+
+// allow reports whether event is enabled and its cooldown is over, allowed event starts a new cooldown
+func (t *AlertTracker) allow(config AlertsConfig, event string, now time.Time) bool {
+	if !config.Enabled(event) {
+		return false
+	}
+
+	if sent, ok := t.sent[event]; ok && now.Sub(sent) < config.GetCooldown() {
+		return false
+	}
+
+	if t.sent == nil {
+		t.sent = make(map[string]time.Time)
+	}
+	t.sent[event] = now
+
+	return true
+}
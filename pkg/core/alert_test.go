@@ -0,0 +1,161 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// alertStep is a status passed to AlertTracker, elapse moves sent alerts back past cooldown before it
+type alertStep struct {
+	status string
+	elapse bool
+	want   []string
+}
+
+// testStatus returns status of a server with 10 slots, down status is nil like a failed query
+func testStatus(state string) *ServerStatus {
+	switch state {
+	case "down":
+		return nil
+	case "empty":
+		return &ServerStatus{Online: true, Players: 0, MaxPlayers: 10}
+	case "full":
+		return &ServerStatus{Online: true, Players: 10, MaxPlayers: 10}
+	}
+
+	return &ServerStatus{Online: true, Players: 5, MaxPlayers: 10}
+}
+
+func TestAlertTracker(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AlertsConfig
+		steps  []alertStep
+	}{
+		{
+			name:  "first status sets state only",
+			steps: []alertStep{{status: "down"}, {status: "down"}},
+		},
+		{
+			name: "down and up",
+			steps: []alertStep{
+				{status: "online"},
+				{status: "down", want: []string{AlertDown}},
+				{status: "down"},
+				{status: "online", want: []string{AlertUp}},
+			},
+		},
+		{
+			name: "offline at start goes up",
+			steps: []alertStep{
+				{status: "down"},
+				{status: "online", want: []string{AlertUp}},
+			},
+		},
+		{
+			name: "skipped down suppresses up",
+			steps: []alertStep{
+				{status: "online"},
+				{status: "down", want: []string{AlertDown}},
+				{status: "online", want: []string{AlertUp}},
+				{status: "down"},
+				{status: "online"},
+			},
+		},
+		{
+			name: "alerts after cooldown",
+			steps: []alertStep{
+				{status: "online"},
+				{status: "down", want: []string{AlertDown}},
+				{status: "online", want: []string{AlertUp}},
+				{status: "down", elapse: true, want: []string{AlertDown}},
+				{status: "online", want: []string{AlertUp}},
+			},
+		},
+		{
+			name:   "custom cooldown",
+			config: AlertsConfig{Cooldown: 3600},
+			steps: []alertStep{
+				{status: "online"},
+				{status: "full", want: []string{AlertFull}},
+				{status: "online"},
+				{status: "full"},
+				{status: "online", elapse: true},
+				{status: "full", want: []string{AlertFull}},
+			},
+		},
+		{
+			name: "full and empty",
+			steps: []alertStep{
+				{status: "online"},
+				{status: "full", want: []string{AlertFull}},
+				{status: "full"},
+				{status: "empty", want: []string{AlertEmpty}},
+				{status: "empty"},
+			},
+		},
+		{
+			name: "server up without players is reported by up only",
+			steps: []alertStep{
+				{status: "online"},
+				{status: "down", want: []string{AlertDown}},
+				{status: "empty", want: []string{AlertUp}},
+			},
+		},
+		{
+			name:   "disabled up",
+			config: AlertsConfig{Events: []string{AlertDown}},
+			steps: []alertStep{
+				{status: "online"},
+				{status: "down", want: []string{AlertDown}},
+				{status: "online"},
+			},
+		},
+		{
+			name:   "disabled down doesn't suppress up",
+			config: AlertsConfig{Events: []string{AlertUp}},
+			steps: []alertStep{
+				{status: "online"},
+				{status: "down"},
+				{status: "online", want: []string{AlertUp}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tracker AlertTracker
+
+			for i, step := range test.steps {
+				if step.elapse {
+					for event, sent := range tracker.sent {
+						tracker.sent[event] = sent.Add(-test.config.GetCooldown())
+					}
+				}
+
+				var events []string
+				for _, alert := range tracker.Update(test.config, testStatus(step.status), nil, time.Time{}) {
+					events = append(events, alert.Event)
+				}
+
+				if !reflect.DeepEqual(events, step.want) {
+					t.Fatalf("step %d (%s): alerts = %v, want %v", i, step.status, events, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertTrackerDowntime(t *testing.T) {
+	var tracker AlertTracker
+	config := AlertsConfig{}
+
+	tracker.Update(config, testStatus("online"), nil, time.Time{})
+	tracker.Update(config, testStatus("down"), nil, time.Now().Add(-time.Hour))
+
+	alerts := tracker.Update(config, testStatus("online"), nil, time.Time{})
+	if len(alerts) != 1 || alerts[0].Downtime < time.Hour {
+		t.Fatalf("up alerts = %+v, want downtime from the last successful query", alerts)
+	}
+}
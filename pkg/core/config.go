@@ -4,12 +4,36 @@ import (
 	"gopkg.in/yaml.v3"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
+const DefaultRefreshDelay = 30
+
 type Config struct {
-	Logger      bool                    `yaml:"logger"`
-	SCPSLConfig SCPSLConfig             `yaml:"scpslConfig"`
-	Servers     map[string]ServerConfig `yaml:"servers"`
+	// Logger is deprecated, use Log.Level debug instead
+	Logger           bool             `yaml:"logger"`
+	Log              LogConfig        `yaml:"log"`
+	ShutdownTimeout  int              `yaml:"shutdownTimeout"`
+	ShutdownPresence string           `yaml:"shutdownPresence"`
+	SCPSLConfig      SCPSLConfig      `yaml:"scpslConfig"`
+	Supervisor       SupervisorConfig `yaml:"supervisor"`
+	HTTP             HTTPConfig       `yaml:"http"`
+	History          HistoryConfig    `yaml:"history"`
+	// StateFile keeps data created by bots between runs, like ids of status messages
+	StateFile string `yaml:"stateFile"`
+	// Presence is a default presence of servers, server presence fields override it
+	Presence PresenceConfig `yaml:"presence"`
+	// Bots are discord bots shared by several servers, servers reference them by name
+	Bots    map[string]BotConfig    `yaml:"bots"`
+	Servers map[string]ServerConfig `yaml:"servers"`
+
+	// DryRun runs monitoring without connecting discord bots, set from command line
+	DryRun bool `yaml:"-"`
+
+	// root is a parsed yaml document, used to report config errors with line numbers
+	root *yaml.Node
 }
 
 type SCPSLConfig struct {
@@ -18,14 +42,279 @@ type SCPSLConfig struct {
 	RefreshDelay *int    `yaml:"refreshDelay"`
 }
 
+// LogConfig controls log output, logs are written to stderr unless file is set
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	File   string `yaml:"file"`
+	// MaxSize is a size of log file in megabytes before it is rotated
+	MaxSize int `yaml:"maxSize"`
+	// MaxBackups is a number of rotated files kept, MaxAge is a number of days they are kept, 0 - keep all
+	MaxBackups int `yaml:"maxBackups"`
+	MaxAge     int `yaml:"maxAge"`
+}
+
+// PresenceConfig sets bot activity types and text templates of online, empty and offline server
+type PresenceConfig struct {
+	Activity        string `yaml:"activity"`
+	OfflineActivity string `yaml:"offlineActivity"`
+	Online          string `yaml:"online"`
+	Empty           string `yaml:"empty"`
+	Offline         string `yaml:"offline"`
+	// Rotation templates are shown in turn after online or empty template while server is online
+	Rotation []string `yaml:"rotation"`
+	// RotationInterval is a number of seconds each rotated text is shown
+	RotationInterval int `yaml:"rotationInterval"`
+}
+
+// BotConfig is a discord bot shared by servers which reference it by name, its presence shows all of them
+type BotConfig struct {
+	BotToken string              `yaml:"botToken"`
+	BotID    string              `yaml:"botID"`
+	Presence GroupPresenceConfig `yaml:"presence"`
+	// Embed is a status message listing all servers of the bot, address is not used
+	Embed EmbedConfig `yaml:"embed"`
+	// Commands registers slash commands of the bot, they answer about its servers by default
+	Commands bool `yaml:"commands"`
+
+	// CompiledPresence is compiled from Presence by Config.Validate
+	CompiledPresence *GroupPresence `yaml:"-"`
+}
+
+// GroupPresenceConfig sets presence of a shared bot, it rotates through its servers or aggregates them
+type GroupPresenceConfig struct {
+	// Mode is rotate or aggregate, rotate by default
+	Mode            string `yaml:"mode"`
+	Activity        string `yaml:"activity"`
+	OfflineActivity string `yaml:"offlineActivity"`
+	// Server is a template of a server shown in rotate mode, it has the same data as presence templates
+	Server string `yaml:"server"`
+	// Aggregate is a template of all servers shown in aggregate mode
+	Aggregate string `yaml:"aggregate"`
+	// RotationInterval is a number of seconds each server is shown in rotate mode
+	RotationInterval int `yaml:"rotationInterval"`
+}
+
+// EmbedConfig controls status message of a server kept up to date by its bot,
+// it is disabled when both ChannelID and Webhook are empty
+type EmbedConfig struct {
+	ChannelID string `yaml:"channelID"`
+	// Webhook is a discord webhook url used instead of ChannelID, server without bot token runs with webhook only
+	Webhook string `yaml:"webhook"`
+	// Address is a server address shown in the message, game info address by default
+	Address string `yaml:"address"`
+}
+
+// CounterConfig controls channel renamed to show server status, it is disabled when ChannelID is empty
+type CounterConfig struct {
+	ChannelID string `yaml:"channelID"`
+	// Template is a Go template of channel name, it has the same data as presence templates
+	Template string `yaml:"template"`
+}
+
+// DebounceConfig delays server state changes until several queries in a row agree
+type DebounceConfig struct {
+	// OfflineAfter is a number of failed queries in a row before server is shown offline, the last online status
+	// is shown until then
+	OfflineAfter int `yaml:"offlineAfter"`
+	// OnlineAfter is a number of successful queries in a row before offline server is shown online
+	OnlineAfter int `yaml:"onlineAfter"`
+	// MarkStale marks the last online status shown while queries fail
+	MarkStale bool `yaml:"markStale"`
+}
+
+// GetOfflineAfter returns number of failed queries in a row before server is offline, 1 by default
+func (c DebounceConfig) GetOfflineAfter() int {
+	return max(c.OfflineAfter, 1)
+}
+
+// GetOnlineAfter returns number of successful queries in a row before server is online, 1 by default
+func (c DebounceConfig) GetOnlineAfter() int {
+	return max(c.OnlineAfter, 1)
+}
+
+// AlertsConfig controls server state change alerts posted to a channel, they are disabled when ChannelID is empty
+type AlertsConfig struct {
+	ChannelID string `yaml:"channelID"`
+	// RoleID is a role mentioned in alerts, empty - no mention
+	RoleID string `yaml:"roleID"`
+	// Events are alerted state changes: down, up, full and empty, all by default
+	Events []string `yaml:"events"`
+	// Cooldown is a minimal number of seconds between alerts of the same event
+	Cooldown int `yaml:"cooldown"`
+}
+
+// Enabled reports whether event is alerted
+func (c AlertsConfig) Enabled(event string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+
+	for _, enabled := range c.Events {
+		if strings.EqualFold(enabled, event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetCooldown returns minimal time between alerts of the same event, 5 minutes by default
+func (c AlertsConfig) GetCooldown() time.Duration {
+	if c.Cooldown <= 0 {
+		return DefaultAlertCooldown
+	}
+
+	return time.Duration(c.Cooldown) * time.Second
+}
+
+// HTTPConfig controls embedded http server with metrics, it is disabled when Listen is empty
+type HTTPConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// HistoryConfig controls player count history store, it is disabled when Path is empty
+type HistoryConfig struct {
+	Path string `yaml:"path"`
+	// RawRetention is a number of days every poll is kept, older polls are downsampled to hourly samples
+	RawRetention int `yaml:"rawRetention"`
+	// HourlyRetention is a number of days hourly samples are kept, 0 - forever
+	HourlyRetention int `yaml:"hourlyRetention"`
+}
+
+// GetRawRetention returns time every poll is kept, 7 days by default
+func (c HistoryConfig) GetRawRetention() time.Duration {
+	if c.RawRetention <= 0 {
+		return 7 * 24 * time.Hour
+	}
+
+	return time.Duration(c.RawRetention) * 24 * time.Hour
+}
+
+// SupervisorConfig controls restarts of failed servers, delays are in seconds
+type SupervisorConfig struct {
+	InitialBackoff int `yaml:"initialBackoff"`
+	MaxBackoff     int `yaml:"maxBackoff"`
+	// MaxRestarts is a number of restarts in a row before server is failed permanently, 0 - unlimited
+	MaxRestarts int `yaml:"maxRestarts"`
+}
+
 type ServerConfig struct {
-	Name         string                 `yaml:"name"`
-	Game         string                 `yaml:"game"`
-	BotToken     string                 `yaml:"botToken"`
-	BotID        string                 `yaml:"botID"`
-	RefreshDelay int                    `yaml:"refreshDelay"`
-	Enabled      bool                   `yaml:"enabled"`
-	Info         map[string]interface{} `yaml:"info"`
+	Name         string    `yaml:"name"`
+	Game         string    `yaml:"game"`
+	BotToken     string    `yaml:"botToken"`
+	BotID        string    `yaml:"botID"`
+	RefreshDelay int       `yaml:"refreshDelay"`
+	Enabled      bool      `yaml:"enabled"`
+	InfoNode     yaml.Node `yaml:"info"`
+	// Presence is merged with global presence and defaults by Config.Validate
+	Presence PresenceConfig `yaml:"presence"`
+	Embed    EmbedConfig    `yaml:"embed"`
+	Counter  CounterConfig  `yaml:"counter"`
+	Alerts   AlertsConfig   `yaml:"alerts"`
+	Debounce DebounceConfig `yaml:"debounce"`
+	// Commands registers /status, /players and /servers slash commands of the bot
+	Commands bool `yaml:"commands"`
+	// Bot is a name of shared bot from bots section, it is used instead of botToken and botID
+	Bot string `yaml:"bot"`
+
+	// Info is a typed game info decoded from info section by Config.Validate,
+	// game packages assert it to their own info struct
+	Info InfoValidator `yaml:"-"`
+	// CompiledPresence is compiled from Presence by Config.Validate
+	CompiledPresence *Presence `yaml:"-"`
+	// CompiledCounter is compiled from Counter by Config.Validate, nil if counter is disabled
+	CompiledCounter *Counter `yaml:"-"`
+	// SharedBot is a bot referenced by Bot, its token and id are copied to the server by Config.Validate
+	SharedBot *BotConfig `yaml:"-"`
+}
+
+// CommandsEnabled reports whether slash commands are registered by the server bot or its shared bot
+func (c ServerConfig) CommandsEnabled() bool {
+	if c.SharedBot != nil {
+		return c.SharedBot.Commands
+	}
+
+	return c.Commands
+}
+
+// WebhookOnly reports whether server has no bot and updates its status message through webhook only
+func (c ServerConfig) WebhookOnly() bool {
+	return c.BotToken == "" && c.BotID == "" && c.Embed.Webhook != ""
+}
+
+// Address returns server address shown to players, embed address or game info address if game has one
+func (c ServerConfig) Address() string {
+	if c.Embed.Address != "" {
+		return c.Embed.Address
+	}
+
+	if addresser, ok := c.Info.(Addresser); ok {
+		return addresser.Address()
+	}
+
+	return ""
+}
+
+// GetShutdownTimeout returns time given to bots to disconnect on shutdown, 10 seconds by default
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return 10 * time.Second
+	}
+
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// GetStateFile returns path of the state file, state.json by default
+func (c *Config) GetStateFile() string {
+	if c.StateFile == "" {
+		return "state.json"
+	}
+
+	return c.StateFile
+}
+
+// Backoff returns delay before restart attempt, starting from 5 seconds and doubled up to 5 minutes by default
+func (c SupervisorConfig) Backoff(attempt int) time.Duration {
+	delay, max := c.initialBackoff(), c.maxBackoff()
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
+
+func (c SupervisorConfig) initialBackoff() time.Duration {
+	if c.InitialBackoff <= 0 {
+		return 5 * time.Second
+	}
+
+	return time.Duration(c.InitialBackoff) * time.Second
+}
+
+func (c SupervisorConfig) maxBackoff() time.Duration {
+	if c.MaxBackoff <= 0 {
+		return 5 * time.Minute
+	}
+
+	return time.Duration(c.MaxBackoff) * time.Second
+}
+
+// EnabledServers returns sorted keys of enabled servers
+func (c *Config) EnabledServers() []string {
+	keys := make([]string, 0, len(c.Servers))
+	for key, server := range c.Servers {
+		if server.Enabled {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
 }
 
 func ParseConfig(path string) (*Config, error) {
@@ -36,12 +325,31 @@ func ParseConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
+	var root yaml.Node
 
-	err = yaml.Unmarshal(yamlFile, &config)
+	err = yaml.Unmarshal(yamlFile, &root)
 	if err != nil {
 		return nil, err
 	}
 
+	config := Config{root: &root}
+	errs := expandSecrets(&root, filepath.Dir(filename))
+
+	// type errors don't stop decoding, so they are reported together with validation errors
+	err = root.Decode(&config)
+	if err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+
+		errs = append(errs, typeErrors(typeErr, "")...)
+	}
+
+	errs = append(errs, config.validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	return &config, nil
 }
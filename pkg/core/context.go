@@ -0,0 +1,24 @@
+package core
+
+import (
+	"context"
+	"io"
+)
+
+// CloseOnDone closes c as soon as ctx is done to interrupt blocking network calls.
+// Returned stop function must be called once c is not used anymore.
+func CloseOnDone(ctx context.Context, c io.Closer) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Close()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Discord allows 2 renames of a channel per 10 minutes, counters never rename more often
+const (
+	CounterRenames      = 2
+	CounterRenameWindow = 10 * time.Minute
+	// MaxChannelName is a discord limit of channel name length
+	MaxChannelName = 100
+)
+
+// defaultCounter is a channel name template used when counter template is not set
+const defaultCounter = "{{if .Online}}🟢 {{.ServerName}}: {{.Players}}/{{.MaxPlayers}}{{else}}🔴 {{.ServerName}}: offline{{end}}"
+
+// Counter is a compiled channel name template of a server
+type Counter struct {
+	template *template.Template
+}
+
+// Render returns channel name of server status, it is cut to discord channel name limit
+func (c *Counter) Render(data PresenceData) (string, error) {
+	var name strings.Builder
+
+	err := c.template.Execute(&name, data)
+	if err != nil {
+		return "", err
+	}
+
+	runes := []rune(strings.TrimSpace(name.String()))
+	if len(runes) > MaxChannelName {
+		runes = runes[:MaxChannelName]
+	}
+
+	return string(runes), nil
+}
+
+// compileCounter parses channel name template of counter config, default template is used if it is empty
+func compileCounter(config CounterConfig) (*Counter, []FieldError) {
+	text := config.Template
+	if text == "" {
+		text = defaultCounter
+	}
+
+	tmpl, err := parseTemplate("template", text, presenceSample)
+	if err != nil {
+		return nil, []FieldError{{Field: "template", Message: templateError(err)}}
+	}
+
+	return &Counter{template: tmpl}, nil
+}
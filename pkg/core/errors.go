@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Query error types, used to group failures in logs, metrics and cli output
+const (
+	ErrorTypeTimeout  = "timeout"
+	ErrorTypeRefused  = "refused"
+	ErrorTypeDNS      = "dns"
+	ErrorTypeNetwork  = "network"
+	ErrorTypeNotFound = "not_found"
+	ErrorTypeCanceled = "canceled"
+	ErrorTypeProtocol = "protocol"
+)
+
+// ClassifyError returns error type of failed query, nil error means server was not found
+func ClassifyError(err error) string {
+	if err == nil {
+		return ErrorTypeNotFound
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrorTypeCanceled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTypeTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTypeTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorTypeRefused
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorTypeDNS
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorTypeNetwork
+	}
+
+	return ErrorTypeProtocol
+}
+
+// permanentError marks failures which can't be fixed by restarting a server
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err, so supervisor doesn't restart server failed with it
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err or any error it wraps was marked by Permanent
+func IsPermanent(err error) bool {
+	var permanentErr *permanentError
+
+	return errors.As(err, &permanentErr)
+}
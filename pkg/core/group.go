@@ -0,0 +1,181 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Presence modes of a bot shared by several servers
+const (
+	// GroupRotate shows servers in turn, one per rotation interval
+	GroupRotate = "rotate"
+	// GroupAggregate shows total players of all servers
+	GroupAggregate = "aggregate"
+)
+
+// defaultGroupPresence is used for presence fields of shared bot not set in config
+var defaultGroupPresence = GroupPresenceConfig{
+	Mode:             GroupRotate,
+	Activity:         "playing",
+	OfflineActivity:  "watching",
+	Server:           "{{.ServerName}}: {{if .Online}}{{.Players}}/{{.MaxPlayers}}{{else}}offline{{end}}",
+	Aggregate:        "{{.Players}}/{{.MaxPlayers}} on {{.Online}}/{{.Servers}} servers",
+	RotationInterval: 30,
+}
+
+// GroupData is available in aggregate presence template of a shared bot, offline servers are not summed
+type GroupData struct {
+	// Servers is a number of servers with known status, Online is a number of online ones
+	Servers    int
+	Online     int
+	Players    int
+	MaxPlayers int
+	// List has presence data of every server, sorted by config key
+	List []PresenceData
+}
+
+// GroupPresence is a compiled presence config of a shared bot
+type GroupPresence struct {
+	Aggregate        bool
+	Activity         int
+	OfflineActivity  int
+	RotationInterval time.Duration
+
+	server    *template.Template
+	aggregate *template.Template
+}
+
+// Steps returns number of presence texts rotated for servers, aggregated presence has a single one
+func (p *GroupPresence) Steps(servers []PresenceData) int {
+	if p.Aggregate && len(servers) > 0 {
+		return 1
+	}
+
+	return len(servers)
+}
+
+// Render returns activity type and text of presence at rotation step together with data which decides bot status.
+// Rotated presence shows a single server, aggregated one shows all of them and is offline only when all servers are.
+func (p *GroupPresence) Render(servers []PresenceData, step int) (int, string, PresenceData, error) {
+	if len(servers) == 0 {
+		return 0, "", PresenceData{}, errors.New("no server statuses to show")
+	}
+
+	tmpl, data := p.server, servers[step%len(servers)]
+	var templateData any = data
+
+	if p.Aggregate {
+		group := GroupData{Servers: len(servers), List: servers}
+		for _, server := range servers {
+			if server.Online {
+				group.Online++
+				group.Players += server.Players
+				group.MaxPlayers += server.MaxPlayers
+			}
+		}
+
+		tmpl, templateData = p.aggregate, group
+		data = PresenceData{ServerStatus: ServerStatus{
+			Online:     group.Online > 0,
+			Players:    group.Players,
+			MaxPlayers: group.MaxPlayers,
+		}}
+	}
+
+	activity := p.Activity
+	if !data.Online {
+		activity = p.OfflineActivity
+	}
+
+	var text strings.Builder
+
+	err := tmpl.Execute(&text, templateData)
+	if err != nil {
+		return 0, "", data, err
+	}
+
+	return activity, strings.TrimSpace(text.String()), data, nil
+}
+
+// merge returns shared bot presence config with empty fields taken from defaults
+func (c GroupPresenceConfig) merge(defaults GroupPresenceConfig) GroupPresenceConfig {
+	pick := func(value string, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+
+		return value
+	}
+
+	merged := GroupPresenceConfig{
+		Mode:             pick(strings.ToLower(c.Mode), defaults.Mode),
+		Activity:         pick(c.Activity, defaults.Activity),
+		OfflineActivity:  pick(c.OfflineActivity, defaults.OfflineActivity),
+		Server:           pick(c.Server, defaults.Server),
+		Aggregate:        pick(c.Aggregate, defaults.Aggregate),
+		RotationInterval: c.RotationInterval,
+	}
+
+	if merged.RotationInterval == 0 {
+		merged.RotationInterval = defaults.RotationInterval
+	}
+
+	return merged
+}
+
+// compileGroupPresence parses templates of complete shared bot presence config and checks them with sample data
+func compileGroupPresence(config GroupPresenceConfig) (*GroupPresence, []FieldError) {
+	var errs []FieldError
+
+	presence := &GroupPresence{Aggregate: config.Mode == GroupAggregate}
+
+	if config.Mode != GroupRotate && config.Mode != GroupAggregate {
+		errs = append(errs, FieldError{
+			Field:   "mode",
+			Message: fmt.Sprintf("unknown mode %q, available: %s, %s", config.Mode, GroupRotate, GroupAggregate),
+		})
+	}
+
+	activity := func(field string, name string) int {
+		value, ok := activityTypes[strings.ToLower(name)]
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("unknown activity %q, available: %s", name, activityNames())})
+		}
+
+		return value
+	}
+
+	presence.Activity = activity("activity", config.Activity)
+	presence.OfflineActivity = activity("offlineActivity", config.OfflineActivity)
+
+	parse := func(field string, text string, sample any) *template.Template {
+		tmpl, err := parseTemplate(field, text, sample)
+		if err != nil {
+			errs = append(errs, FieldError{Field: field, Message: templateError(err)})
+		}
+
+		return tmpl
+	}
+
+	presence.server = parse("server", config.Server, presenceSample)
+	presence.aggregate = parse("aggregate", config.Aggregate, GroupData{
+		Servers:    1,
+		Online:     1,
+		Players:    presenceSample.Players,
+		MaxPlayers: presenceSample.MaxPlayers,
+		List:       []PresenceData{presenceSample},
+	})
+
+	if config.RotationInterval < MinRotationInterval {
+		errs = append(errs, FieldError{
+			Field:   "rotationInterval",
+			Message: fmt.Sprintf("must be at least %d seconds to respect discord rate limits", MinRotationInterval),
+		})
+	}
+	presence.RotationInterval = time.Duration(config.RotationInterval) * time.Second
+
+	return presence, errs
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats available in config
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// GetLogLevel returns configured log level, info by default.
+// Deprecated logger option enables debug level when level is not set.
+func (c *Config) GetLogLevel() slog.Level {
+	level, ok := parseLogLevel(c.Log.Level)
+	if !ok || c.Log.Level == "" {
+		if c.Logger {
+			return slog.LevelDebug
+		}
+
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// NewLogger builds logger from log section of config, returned closer closes log file
+func NewLogger(config *Config) (*slog.Logger, io.Closer, error) {
+	if _, ok := parseLogLevel(config.Log.Level); !ok {
+		return nil, nil, errors.New(fmt.Sprintf("unknown log level %q, available: debug, info, warn, error", config.Log.Level))
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stderr}
+
+	if config.Log.File != "" {
+		out = &lumberjack.Logger{
+			Filename:   config.Log.File,
+			MaxSize:    config.Log.MaxSize,
+			MaxBackups: config.Log.MaxBackups,
+			MaxAge:     config.Log.MaxAge,
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: config.GetLogLevel()}
+
+	switch strings.ToLower(config.Log.Format) {
+	case "", LogFormatText:
+		return slog.New(slog.NewTextHandler(out, options)), out, nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(out, options)), out, nil
+	default:
+		return nil, nil, errors.New(fmt.Sprintf("unknown log format %q, available: %s, %s", config.Log.Format, LogFormatText, LogFormatJSON))
+	}
+}
+
+// parseLogLevel parses level name, empty name is info level
+func parseLogLevel(name string) (slog.Level, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "", "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+
+	return slog.LevelInfo, false
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
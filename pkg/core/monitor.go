@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// Querier fetches current info of a single configured server
+type Querier interface {
+	Query(ctx context.Context, serverConfig ServerConfig) (*ServerStatus, error)
+}
+
+// Monitor runs monitoring of configured servers of a single game
+type Monitor interface {
+	Querier
+	// Run keeps poller of a single server running and its bot connected.
+	// It blocks until ctx is done or server can not be monitored anymore, returned error is the reason then.
+	// Server config can be changed while running, so it must be read from poller.
+	Run(ctx context.Context, poller *Poller) error
+}
+
+// Addresser is implemented by game info with an address players connect to
+type Addresser interface {
+	Address() string
+}
+
+// MapDisplayer is implemented by game info with option to show current map in bot presence
+type MapDisplayer interface {
+	ShowMap() bool
+}
+
+// MonitorFactory creates game monitor, called once per game on startup.
+// Background work of the monitor must stop when ctx is done, logger already has game field.
+type MonitorFactory func(ctx context.Context, config *Config, logger *slog.Logger) (Monitor, error)
+
+// Game describes supported game, registered by game packages
+type Game struct {
+	CreateMonitor MonitorFactory
+	// NewInfo returns pointer to game info struct filled with default values,
+	// info section of server config is decoded into it
+	NewInfo func() InfoValidator
+	// AddressField is an info key of the server address, empty if game servers are not queried directly
+	AddressField string
+	// Validate checks game wide settings of the config, optional.
+	// It is called only when config has at least one enabled server of the game.
+	Validate func(config *Config) []FieldError
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Game)
+)
+
+// RegisterGame makes game available by its game key used in config.
+// Game packages call it from their init function.
+func RegisterGame(key string, game Game) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if game.CreateMonitor == nil || game.NewInfo == nil {
+		panic("core: RegisterGame CreateMonitor and NewInfo are required")
+	}
+
+	if _, dup := registry[key]; dup {
+		panic(fmt.Sprintf("core: RegisterGame called twice for game %s", key))
+	}
+
+	registry[key] = game
+}
+
+// Games returns sorted list of registered game keys
+func Games() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	games := make([]string, 0, len(registry))
+	for game := range registry {
+		games = append(games, game)
+	}
+	sort.Strings(games)
+
+	return games
+}
+
+func GetGame(key string) (Game, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	game, ok := registry[key]
+
+	return game, ok
+}
+
+func CreateMonitor(ctx context.Context, key string, config *Config, logger *slog.Logger) (Monitor, error) {
+	game, ok := GetGame(key)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown game %q, available: %v", key, Games()))
+	}
+
+	return game.CreateMonitor(ctx, config, logger.With("game", key))
+}
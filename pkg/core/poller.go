@@ -0,0 +1,308 @@
+package core
+
+import (
+	"DiscordMBM/pkg/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/teivah/broadcast"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Bot connection states reported by server bots
+const (
+	BotConnecting   = "connecting"
+	BotConnected    = "connected"
+	BotDisconnected = "disconnected"
+	BotDryRun       = "dry_run"
+	// BotWebhook servers have no bot and only update status message through webhook
+	BotWebhook = "webhook"
+)
+
+// Recorder receives every published status of every server, it must not block polling
+type Recorder interface {
+	Record(key string, at time.Time, status *ServerStatus)
+}
+
+// Directory gives bots access to reports of all configured servers, it is implemented by Supervisor
+type Directory interface {
+	Reports() []ServerReport
+	Report(key string) (ServerReport, bool)
+}
+
+// ChartFunc draws players chart of the server for period ending now as PNG
+type ChartFunc func(ctx context.Context, w io.Writer, key string, title string, period string) error
+
+// Poller queries a single server and publishes its status to subscribers.
+// It doesn't depend on discord connection, so monitoring keeps running while discord is down.
+type Poller struct {
+	// Key is a unique server key from config
+	Key   string
+	Relay *broadcast.Relay[*ServerStatus]
+
+	querier Querier
+	logger  *slog.Logger
+	updated chan struct{}
+	// recorders, stateFile, directory, chart and baseLogger are set by supervisor before poller is run
+	recorders  []Recorder
+	stateFile  *StateFile
+	directory  Directory
+	chart      ChartFunc
+	baseLogger *slog.Logger
+
+	mu           sync.RWMutex
+	serverConfig ServerConfig
+	// last is the latest published status, lastGood is the latest online status returned by query
+	last        *ServerStatus
+	lastGood    *ServerStatus
+	lastErr     error
+	lastQuery   time.Time
+	lastSuccess time.Time
+	onlineSince time.Time
+	botState    string
+	// failures and successes count queries in a row, they are compared with debounce thresholds
+	failures  int
+	successes int
+	// peak is the most players seen on peakDay
+	peak    int
+	peakDay string
+}
+
+// NewPoller creates poller of the server, logger is expected to have server fields
+func NewPoller(querier Querier, key string, serverConfig ServerConfig, logger *slog.Logger) *Poller {
+	return &Poller{
+		Key:          key,
+		Relay:        broadcast.NewRelay[*ServerStatus](),
+		querier:      querier,
+		logger:       logger,
+		updated:      make(chan struct{}, 1),
+		serverConfig: serverConfig,
+	}
+}
+
+// Config returns current server config
+func (p *Poller) Config() ServerConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.serverConfig
+}
+
+// Logger returns logger of the server, it is shared with server monitor and bot
+func (p *Poller) Logger() *slog.Logger {
+	return p.logger
+}
+
+// SetConfig applies changed server config to the running poller, server is queried again immediately
+func (p *Poller) SetConfig(serverConfig ServerConfig) {
+	p.mu.Lock()
+	p.serverConfig = serverConfig
+	p.mu.Unlock()
+
+	select {
+	case p.updated <- struct{}{}:
+	default:
+	}
+}
+
+// Run queries server every refreshDelay seconds until ctx is done
+func (p *Poller) Run(ctx context.Context) {
+	for {
+		status, err := p.query(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		p.Publish(status, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.updated:
+		case <-time.After(time.Duration(p.Config().RefreshDelay) * time.Second):
+		}
+	}
+}
+
+// Publish stores status as the latest one and sends it to subscribers.
+// Nil status means server is offline. Online state changes are delayed by debounce config of the server.
+func (p *Poller) Publish(status *ServerStatus, err error) {
+	game := p.Config().Game
+
+	if err != nil {
+		p.logger.Debug("Server query failed", "error", err, "errorType", ClassifyError(err))
+	}
+
+	if status == nil {
+		p.logger.Debug("Server not found")
+
+		status = &ServerStatus{Online: false}
+	} else {
+		p.logger.Debug("Server found", "players", status.Players, "maxPlayers", status.MaxPlayers)
+	}
+
+	if status.Online {
+		metrics.QuerySucceeded(p.Key, game, status.Players, status.MaxPlayers, status.Latency)
+	} else {
+		metrics.QueryFailed(p.Key, game, ClassifyError(err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastErr = err
+	p.lastQuery = time.Now()
+	if status.Online {
+		p.lastSuccess = p.lastQuery
+		p.lastGood = status
+		p.failures, p.successes = 0, p.successes+1
+	} else {
+		p.failures, p.successes = p.failures+1, 0
+	}
+
+	if day := p.lastQuery.Format(time.DateOnly); day != p.peakDay {
+		p.peak, p.peakDay = 0, day
+	}
+	if status.Online && status.Players > p.peak {
+		p.peak = status.Players
+	}
+
+	status = p.debounce(status)
+
+	p.last = status
+	if !status.Online {
+		p.onlineSince = time.Time{}
+	} else if p.onlineSince.IsZero() {
+		p.onlineSince = p.lastQuery
+	}
+
+	// slow subscribers skip statuses instead of blocking polling
+	p.Relay.Broadcast(status)
+
+	for _, recorder := range p.recorders {
+		recorder.Record(p.Key, p.lastQuery, status)
+	}
+}
+
+// debounce returns status to publish, published online state changes only after
+// configured number of queries in a row agree with it
+func (p *Poller) debounce(status *ServerStatus) *ServerStatus {
+	config := p.serverConfig.Debounce
+
+	switch {
+	case p.last == nil || status.Online == p.last.Online:
+		return status
+	case !status.Online && p.failures < config.GetOfflineAfter():
+		p.logger.Debug("Server offline state is delayed", "failures", p.failures)
+
+		stale := *p.lastGood
+		stale.Stale = config.MarkStale
+
+		return &stale
+	case status.Online && p.successes < config.GetOnlineAfter():
+		p.logger.Debug("Server online state is delayed", "successes", p.successes)
+
+		return p.last
+	}
+
+	return status
+}
+
+// Subscribe returns listener of published statuses together with the latest status published before,
+// so subscriber doesn't miss anything. Latest status is nil before the first query.
+func (p *Poller) Subscribe() (*broadcast.Listener[*ServerStatus], *ServerStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.Relay.Listener(1), p.last
+}
+
+// Last returns the latest published status and query error, status is nil before the first query
+func (p *Poller) Last() (*ServerStatus, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.last, p.lastErr
+}
+
+// LastQuery returns times of the latest query and the latest query which found server online, zero if none
+func (p *Poller) LastQuery() (last time.Time, success time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.lastQuery, p.lastSuccess
+}
+
+// OnlineSince returns time server was found online after being offline, zero while it is offline
+func (p *Poller) OnlineSince() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.onlineSince
+}
+
+// BaseLogger returns supervisor logger without server fields, it is used by bots shared by several servers
+func (p *Poller) BaseLogger() *slog.Logger {
+	if p.baseLogger == nil {
+		return slog.Default()
+	}
+
+	return p.baseLogger
+}
+
+// Chart returns players chart renderer, nil when charts are not available
+func (p *Poller) Chart() ChartFunc {
+	return p.chart
+}
+
+// StateFile returns state file shared by all servers, nil when poller is not run by supervisor
+func (p *Poller) StateFile() *StateFile {
+	return p.stateFile
+}
+
+// Directory returns reports of all servers, nil when poller is not run by supervisor
+func (p *Poller) Directory() Directory {
+	return p.directory
+}
+
+// PeakToday returns the most players seen today
+func (p *Poller) PeakToday() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.peakDay != time.Now().Format(time.DateOnly) {
+		return 0
+	}
+
+	return p.peak
+}
+
+// SetBotState is called by server bot when its discord connection changes
+func (p *Poller) SetBotState(state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.botState = state
+}
+
+// BotState returns connection state of server bot, empty before bot is started
+func (p *Poller) BotState() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.botState
+}
+
+func (p *Poller) query(ctx context.Context) (status *ServerStatus, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			status = nil
+			err = errors.New(fmt.Sprintf("query panic: %v", r))
+		}
+	}()
+
+	return p.querier.Query(ctx, p.Config())
+}
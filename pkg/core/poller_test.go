@@ -0,0 +1,114 @@
+package core
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// debounceStep is a query result published to poller, negative players mean failed query
+type debounceStep struct {
+	players int
+	// want is players of published status, negative - offline status
+	want      int
+	wantStale bool
+}
+
+func TestPollerDebounce(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DebounceConfig
+		steps  []debounceStep
+	}{
+		{
+			name:  "no debounce",
+			steps: []debounceStep{{players: 1, want: 1}, {players: -1, want: -1}, {players: 2, want: 2}},
+		},
+		{
+			name:  "first status is not delayed",
+			steps: []debounceStep{{players: -1, want: -1}, {players: 1, want: 1}},
+		},
+		{
+			name:   "offline after failures in a row",
+			config: DebounceConfig{OfflineAfter: 3},
+			steps: []debounceStep{
+				{players: 1, want: 1},
+				{players: -1, want: 1},
+				{players: -1, want: 1},
+				{players: -1, want: -1},
+				{players: -1, want: -1},
+			},
+		},
+		{
+			name:   "success resets failures",
+			config: DebounceConfig{OfflineAfter: 2},
+			steps: []debounceStep{
+				{players: 1, want: 1},
+				{players: -1, want: 1},
+				{players: 2, want: 2},
+				{players: -1, want: 2},
+				{players: -1, want: -1},
+			},
+		},
+		{
+			name:   "online after successes in a row",
+			config: DebounceConfig{OnlineAfter: 2},
+			steps: []debounceStep{
+				{players: -1, want: -1},
+				{players: 1, want: -1},
+				{players: -1, want: -1},
+				{players: 2, want: -1},
+				{players: 3, want: 3},
+			},
+		},
+		{
+			name:   "stale status is marked",
+			config: DebounceConfig{OfflineAfter: 2, MarkStale: true},
+			steps: []debounceStep{
+				{players: 1, want: 1},
+				{players: -1, want: 1, wantStale: true},
+				{players: 2, want: 2},
+			},
+		},
+		{
+			name:   "stale status is the latest good one",
+			config: DebounceConfig{OfflineAfter: 2, OnlineAfter: 2, MarkStale: true},
+			steps: []debounceStep{
+				{players: 1, want: 1},
+				{players: -1, want: 1, wantStale: true},
+				{players: -1, want: -1},
+				// delayed online status is kept as the latest good one
+				{players: 2, want: -1},
+				{players: 3, want: 3},
+				{players: -1, want: 3, wantStale: true},
+				{players: -1, want: -1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			poller := NewPoller(nil, "test-debounce", ServerConfig{Game: "test", Debounce: test.config}, logger)
+
+			for i, step := range test.steps {
+				var status *ServerStatus
+				if step.players >= 0 {
+					status = &ServerStatus{Online: true, Players: step.players, MaxPlayers: 10}
+				}
+
+				poller.Publish(status, nil)
+
+				got, _ := poller.Last()
+				switch {
+				case step.want < 0 && got.Online:
+					t.Fatalf("step %d: published online status with %d players, want offline", i, got.Players)
+				case step.want >= 0 && (!got.Online || got.Players != step.want):
+					t.Fatalf("step %d: published online %t with %d players, want %d players", i, got.Online, got.Players, step.want)
+				case got.Stale != step.wantStale:
+					t.Fatalf("step %d: published stale = %t, want %t", i, got.Stale, step.wantStale)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Activity types of bot presence, values are discord activity types
+const (
+	ActivityPlaying   = 0
+	ActivityListening = 2
+	ActivityWatching  = 3
+	ActivityCustom    = 4
+	ActivityCompeting = 5
+)
+
+var activityTypes = map[string]int{
+	"playing":   ActivityPlaying,
+	"listening": ActivityListening,
+	"watching":  ActivityWatching,
+	"custom":    ActivityCustom,
+	"competing": ActivityCompeting,
+}
+
+// MinRotationInterval keeps rotated presence updates within discord rate limits
+const MinRotationInterval = 15
+
+// defaultPresence is used for presence fields not set in config
+var defaultPresence = PresenceConfig{
+	Activity:         "playing",
+	OfflineActivity:  "watching",
+	Online:           "{{.Players}}/{{.MaxPlayers}}{{if and .ShowMap .Map}} on {{.Map}}{{end}}{{if .Stale}} (stale){{end}}",
+	Empty:            "{{.Players}}/{{.MaxPlayers}}{{if and .ShowMap .Map}} on {{.Map}}{{end}}{{if .Stale}} (stale){{end}}",
+	Offline:          "offline",
+	RotationInterval: 30,
+}
+
+// PresenceData is available in presence templates, status fields are zero while server is offline
+type PresenceData struct {
+	ServerStatus
+	// ServerName is a server name from config, Name is a name reported by server
+	ServerName string
+	// ShowMap is set by mapInfo option of game info
+	ShowMap bool
+	// Peak is the most players seen today
+	Peak int
+}
+
+// Presence is a compiled presence config of a server
+type Presence struct {
+	Activity         int
+	OfflineActivity  int
+	RotationInterval time.Duration
+
+	online   *template.Template
+	empty    *template.Template
+	offline  *template.Template
+	rotation []*template.Template
+}
+
+// Steps returns number of presence texts rotated for server status, offline server has a single one
+func (p *Presence) Steps(data PresenceData) int {
+	if !data.Online {
+		return 1
+	}
+
+	return 1 + len(p.rotation)
+}
+
+// Render returns activity type and text of presence matching server status.
+// Step selects text of online server, step 0 is online or empty template and the next ones are rotation templates.
+func (p *Presence) Render(data PresenceData, step int) (int, string, error) {
+	tmpl, activity := p.online, p.Activity
+
+	switch {
+	case !data.Online:
+		tmpl, activity = p.offline, p.OfflineActivity
+	case step%p.Steps(data) > 0:
+		tmpl = p.rotation[step%p.Steps(data)-1]
+	case data.Players == 0:
+		tmpl = p.empty
+	}
+
+	var text strings.Builder
+
+	err := tmpl.Execute(&text, data)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return activity, strings.TrimSpace(text.String()), nil
+}
+
+// merge returns presence config with empty fields taken from defaults
+func (c PresenceConfig) merge(defaults PresenceConfig) PresenceConfig {
+	pick := func(value string, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+
+		return value
+	}
+
+	merged := PresenceConfig{
+		Activity:         pick(c.Activity, defaults.Activity),
+		OfflineActivity:  pick(c.OfflineActivity, defaults.OfflineActivity),
+		Online:           pick(c.Online, defaults.Online),
+		Empty:            pick(c.Empty, defaults.Empty),
+		Offline:          pick(c.Offline, defaults.Offline),
+		Rotation:         c.Rotation,
+		RotationInterval: c.RotationInterval,
+	}
+
+	if len(merged.Rotation) == 0 {
+		merged.Rotation = defaults.Rotation
+	}
+	if merged.RotationInterval == 0 {
+		merged.RotationInterval = defaults.RotationInterval
+	}
+
+	return merged
+}
+
+// overrides reports whether presence field is set, field is a yaml name reported by compilePresence
+func (c PresenceConfig) overrides(field string) bool {
+	switch field {
+	case "activity":
+		return c.Activity != ""
+	case "offlineActivity":
+		return c.OfflineActivity != ""
+	case "online":
+		return c.Online != ""
+	case "empty":
+		return c.Empty != ""
+	case "offline":
+		return c.Offline != ""
+	case "rotationInterval":
+		return c.RotationInterval != 0
+	}
+
+	return strings.HasPrefix(field, "rotation.") && len(c.Rotation) > 0
+}
+
+// compilePresence parses templates of complete presence config and checks them with sample status
+func compilePresence(config PresenceConfig) (*Presence, []FieldError) {
+	var errs []FieldError
+
+	presence := &Presence{}
+
+	activity := func(field string, name string) int {
+		value, ok := activityTypes[strings.ToLower(name)]
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("unknown activity %q, available: %s", name, activityNames())})
+		}
+
+		return value
+	}
+
+	presence.Activity = activity("activity", config.Activity)
+	presence.OfflineActivity = activity("offlineActivity", config.OfflineActivity)
+
+	parse := func(field string, text string) *template.Template {
+		tmpl, err := parseTemplate(field, text, presenceSample)
+		if err != nil {
+			errs = append(errs, FieldError{Field: field, Message: templateError(err)})
+		}
+
+		return tmpl
+	}
+
+	presence.online = parse("online", config.Online)
+	presence.empty = parse("empty", config.Empty)
+	presence.offline = parse("offline", config.Offline)
+
+	for i, text := range config.Rotation {
+		presence.rotation = append(presence.rotation, parse(fmt.Sprintf("rotation.%d", i), text))
+	}
+
+	if config.RotationInterval < MinRotationInterval {
+		errs = append(errs, FieldError{
+			Field:   "rotationInterval",
+			Message: fmt.Sprintf("must be at least %d seconds to respect discord rate limits", MinRotationInterval),
+		})
+	}
+	presence.RotationInterval = time.Duration(config.RotationInterval) * time.Second
+
+	return presence, errs
+}
+
+// presenceSample is an online status used to check presence templates
+var presenceSample = PresenceData{
+	ServerStatus: ServerStatus{Online: true, Players: 1, MaxPlayers: 2, Extra: map[string]string{}},
+	ServerName:   "sample",
+}
+
+// parseTemplate parses template and checks it with sample data
+func parseTemplate(name string, text string, sample any) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(&strings.Builder{}, sample)
+	}
+
+	return tmpl, err
+}
+
+func activityNames() string {
+	names := make([]string, 0, len(activityTypes))
+	for name := range activityTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// templateError drops template name prefix, field path is reported separately
+func templateError(err error) string {
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		err = execErr.Err
+	}
+
+	message := err.Error()
+	if _, rest, ok := strings.Cut(message, ": "); ok && strings.HasPrefix(message, "template: ") {
+		return "invalid template: " + rest
+	}
+
+	return "invalid template: " + message
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const secretFilePrefix = "file:"
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)}`)
+
+// expandSecrets replaces ${ENV_VAR} references in config values with environment variables
+// and "file:path" values with the file content, relative paths are resolved from baseDir.
+// Secrets don't have to be stored in config then.
+func expandSecrets(node *yaml.Node, baseDir string) ConfigErrors {
+	var errs ConfigErrors
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		// keys are left as is, only values are expanded
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, expandSecrets(node.Content[i], baseDir)...)
+		}
+
+		return errs
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			errs = append(errs, expandSecrets(child, baseDir)...)
+		}
+
+		return errs
+	case yaml.AliasNode:
+		return errs
+	}
+
+	value := envVarPattern.ReplaceAllStringFunc(node.Value, func(ref string) string {
+		name := envVarPattern.FindStringSubmatch(ref)[1]
+
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			errs = append(errs, ConfigError{
+				Line:    node.Line,
+				Message: fmt.Sprintf("environment variable %s is not set", name),
+			})
+		}
+
+		return env
+	})
+
+	if strings.HasPrefix(value, secretFilePrefix) {
+		path := strings.TrimPrefix(value, secretFilePrefix)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, ConfigError{Line: node.Line, Message: fmt.Sprintf("failed to read secret file: %s", err.Error())})
+		}
+
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if value != node.Value {
+		node.Value = value
+
+		// let plain values like ${SERVER_ID} be resolved to numbers and booleans again
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MBM_TEST_TOKEN", "env-token")
+	t.Setenv("MBM_TEST_ID", "42")
+	t.Setenv("MBM_TEST_ENABLED", "true")
+
+	tests := []struct {
+		name string
+		yaml string
+		want map[string]any
+		// errLines are lines of expected errors
+		errLines []int
+	}{
+		{
+			name: "plain values",
+			yaml: "token: abc\nid: 1",
+			want: map[string]any{"token": "abc", "id": 1},
+		},
+		{
+			name: "env variable",
+			yaml: "token: ${MBM_TEST_TOKEN}",
+			want: map[string]any{"token": "env-token"},
+		},
+		{
+			name: "env variable inside text",
+			yaml: `url: "https://host/${MBM_TEST_TOKEN}/x"`,
+			want: map[string]any{"url": "https://host/env-token/x"},
+		},
+		{
+			name: "plain env values are typed again",
+			yaml: "id: ${MBM_TEST_ID}\nenabled: ${MBM_TEST_ENABLED}",
+			want: map[string]any{"id": 42, "enabled": true},
+		},
+		{
+			name: "quoted env values stay strings",
+			yaml: `id: "${MBM_TEST_ID}"`,
+			want: map[string]any{"id": "42"},
+		},
+		{
+			name: "relative secret file",
+			yaml: "token: file:token",
+			want: map[string]any{"token": "file-token"},
+		},
+		{
+			name: "absolute secret file",
+			yaml: "token: file:" + filepath.Join(dir, "token"),
+			want: map[string]any{"token": "file-token"},
+		},
+		{
+			name: "nested values and lists",
+			yaml: "servers:\n  a:\n    token: ${MBM_TEST_TOKEN}\n    list:\n      - ${MBM_TEST_ID}",
+			want: map[string]any{"servers": map[string]any{"a": map[string]any{"token": "env-token", "list": []any{42}}}},
+		},
+		{
+			name: "keys are not expanded",
+			yaml: "${MBM_TEST_TOKEN}: x",
+			want: map[string]any{"${MBM_TEST_TOKEN}": "x"},
+		},
+		{
+			name:     "missing env variable",
+			yaml:     "a: 1\ntoken: ${MBM_TEST_MISSING}",
+			want:     map[string]any{"a": 1, "token": nil},
+			errLines: []int{2},
+		},
+		{
+			name:     "missing secret file",
+			yaml:     "a: 1\nb: 2\ntoken: file:missing",
+			want:     map[string]any{"a": 1, "b": 2, "token": nil},
+			errLines: []int{3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var root yaml.Node
+			if err := yaml.Unmarshal([]byte(test.yaml), &root); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := expandSecrets(&root, dir)
+
+			if len(errs) != len(test.errLines) {
+				t.Fatalf("expandSecrets() errors = %v, want %d errors", errs, len(test.errLines))
+			}
+			for i, line := range test.errLines {
+				if errs[i].Line != line {
+					t.Errorf("error %d line = %d, want %d", i, errs[i].Line, line)
+				}
+			}
+
+			var got map[string]any
+			if err := root.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expanded = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StateFile persists small values between runs, like ids of messages created by bots
+type StateFile struct {
+	path string
+
+	mu     sync.Mutex
+	values map[string]json.RawMessage
+}
+
+// OpenStateFile reads state file, missing file is an empty state
+func OpenStateFile(path string) (*StateFile, error) {
+	state := &StateFile{path: path, values: make(map[string]json.RawMessage)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &state.values)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to parse state file %s: %s", path, err.Error()))
+	}
+
+	return state, nil
+}
+
+// Get decodes value stored by key into value, false if there is no such key
+func (s *StateFile) Get(key string, value any) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.values[key]
+	if !ok {
+		return false
+	}
+
+	return json.Unmarshal(data, value) == nil
+}
+
+// Set stores value by key and writes state file, file is replaced atomically
+func (s *StateFile) Set(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = data
+
+	file, err := json.MarshalIndent(s.values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
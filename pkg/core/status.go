@@ -0,0 +1,20 @@
+package core
+
+import "time"
+
+// ServerStatus is a result of a single game server query
+type ServerStatus struct {
+	Online     bool              `json:"online"`
+	Players    int               `json:"players"`
+	MaxPlayers int               `json:"maxPlayers"`
+	Bots       int               `json:"bots"`
+	Map        string            `json:"map,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	GameMode   string            `json:"gameMode,omitempty"`
+	PlayerList []string          `json:"playerList,omitempty"`
+	Latency    time.Duration     `json:"latency"`
+	Extra      map[string]string `json:"extra,omitempty"`
+	// Stale is set by poller on the last online status republished while failed queries are debounced
+	Stale bool `json:"stale,omitempty"`
+}
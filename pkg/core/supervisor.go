@@ -0,0 +1,466 @@
+package core
+
+import (
+	"DiscordMBM/pkg/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Server states reported by supervisor
+const (
+	StateRunning    = "running"
+	StateBackingOff = "backing_off"
+	StateFailed     = "failed"
+)
+
+// ServerState describes lifecycle of a supervised server
+type ServerState struct {
+	State string
+	// Reason is an error which stopped the latest server run
+	Reason string
+	// Restarts is a total number of server restarts after failures
+	Restarts int
+	Since    time.Time
+	// RetryAt is a time of the next restart while backing off
+	RetryAt time.Time
+}
+
+// Supervisor owns lifecycle of monitored servers and applies config changes to them without
+// touching servers which didn't change. Failed servers are restarted with exponential backoff.
+type Supervisor struct {
+	ctx    context.Context
+	logger *slog.Logger
+	// applyMu makes reloads apply one at a time, mu is released while stopped servers finish
+	applyMu sync.Mutex
+
+	mu     sync.Mutex
+	config *Config
+	// serverConfigs are servers of the latest applied config, including disabled ones
+	serverConfigs map[string]ServerConfig
+	monitors      map[string]Monitor
+	servers       map[string]*runningServer
+	recorders     []Recorder
+	stateFile     *StateFile
+	chart         ChartFunc
+}
+
+// ServerReport is the latest known state of a configured server
+type ServerReport struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Game    string `json:"game"`
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address,omitempty"`
+	// State is a supervisor state of enabled server, Reason is an error which stopped its latest run
+	State       string        `json:"state,omitempty"`
+	Reason      string        `json:"reason,omitempty"`
+	Bot         string        `json:"bot,omitempty"`
+	Status      *ServerStatus `json:"status,omitempty"`
+	LastQuery   *time.Time    `json:"lastQuery,omitempty"`
+	LastSuccess *time.Time    `json:"lastSuccess,omitempty"`
+	OnlineSince *time.Time    `json:"onlineSince,omitempty"`
+	LastError   string        `json:"lastError,omitempty"`
+	ErrorType   string        `json:"errorType,omitempty"`
+}
+
+type runningServer struct {
+	poller *Poller
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	state ServerState
+}
+
+func NewSupervisor(ctx context.Context, logger *slog.Logger) *Supervisor {
+	return &Supervisor{
+		ctx:      ctx,
+		logger:   logger,
+		monitors: make(map[string]Monitor),
+		servers:  make(map[string]*runningServer),
+	}
+}
+
+// AddRecorder adds recorder of statuses of all servers, it must be called before Apply
+func (s *Supervisor) AddRecorder(recorder Recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorders = append(s.recorders, recorder)
+}
+
+// SetStateFile sets state file of all servers, it must be called before Apply
+func (s *Supervisor) SetStateFile(stateFile *StateFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stateFile = stateFile
+}
+
+// SetChart sets players chart renderer of all servers, it must be called before Apply
+func (s *Supervisor) SetChart(chart ChartFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chart = chart
+}
+
+// Apply makes running servers match config: new servers are started, removed and disabled ones stopped,
+// servers with changed bot settings restarted and other changes applied to running pollers.
+func (s *Supervisor) Apply(config *Config) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	s.mu.Lock()
+
+	if s.config == nil {
+		s.config = config
+	} else if globalSettingsChanged(s.config, config) {
+		s.logger.Warn("Global config settings changed, restart to apply them. Only servers section is reloaded")
+	}
+
+	s.serverConfigs = config.Servers
+
+	var stopped []*runningServer
+
+	for key, server := range s.servers {
+		newConfig, ok := config.Servers[key]
+		oldConfig := server.poller.Config()
+		logger := server.poller.Logger()
+
+		switch {
+		case !ok || !newConfig.Enabled:
+			logger.Info("Stopping server")
+			stopped = append(stopped, s.stop(key))
+			metrics.DeleteServer(key)
+		case needsRestart(oldConfig, newConfig):
+			logger.Info("Restarting server")
+			stopped = append(stopped, s.stop(key))
+		case settingsChanged(oldConfig, newConfig):
+			// failed server gets another chance after its config is fixed
+			if server.State().State == StateFailed {
+				logger.Info("Restarting failed server")
+				stopped = append(stopped, s.stop(key))
+				continue
+			}
+
+			logger.Info("Updating server")
+			server.poller.SetConfig(newConfig)
+		}
+	}
+
+	timeout := s.config.GetShutdownTimeout()
+	s.mu.Unlock()
+
+	// reports are served while stopped servers disconnect their bots
+	waitStopped(stopped, timeout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range config.EnabledServers() {
+		if _, ok := s.servers[key]; !ok {
+			s.start(key, config.Servers[key])
+		}
+	}
+}
+
+// States returns states of supervised servers by server key
+func (s *Supervisor) States() map[string]ServerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]ServerState, len(s.servers))
+	for key, server := range s.servers {
+		states[key] = server.State()
+	}
+
+	return states
+}
+
+// Reports returns reports of all configured servers sorted by key
+func (s *Supervisor) Reports() []ServerReport {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.serverConfigs))
+	for key := range s.serverConfigs {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(keys)
+
+	reports := make([]ServerReport, 0, len(keys))
+	for _, key := range keys {
+		if report, ok := s.Report(key); ok {
+			reports = append(reports, report)
+		}
+	}
+
+	return reports
+}
+
+// Report returns report of a configured server, false if there is no server with the key
+func (s *Supervisor) Report(key string) (ServerReport, bool) {
+	s.mu.Lock()
+	serverConfig, ok := s.serverConfigs[key]
+	server := s.servers[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return ServerReport{}, false
+	}
+
+	report := ServerReport{
+		Key:     key,
+		Name:    serverConfig.Name,
+		Game:    serverConfig.Game,
+		Enabled: serverConfig.Enabled,
+		Address: serverConfig.Address(),
+	}
+
+	if server == nil {
+		return report, true
+	}
+
+	state := server.State()
+	report.State, report.Reason = state.State, state.Reason
+	report.Bot = server.poller.BotState()
+
+	status, err := server.poller.Last()
+	report.Status = status
+	if status != nil && !status.Online {
+		report.ErrorType = ClassifyError(err)
+	}
+	if err != nil {
+		report.LastError = err.Error()
+	}
+
+	lastQuery, lastSuccess := server.poller.LastQuery()
+	if !lastQuery.IsZero() {
+		report.LastQuery = &lastQuery
+	}
+	if !lastSuccess.IsZero() {
+		report.LastSuccess = &lastSuccess
+	}
+	if onlineSince := server.poller.OnlineSince(); !onlineSince.IsZero() {
+		report.OnlineSince = &onlineSince
+	}
+
+	return report, true
+}
+
+// Wait blocks until all servers are stopped after supervisor context is done or timeout is exceeded
+func (s *Supervisor) Wait(timeout time.Duration) bool {
+	s.mu.Lock()
+	servers := make([]*runningServer, 0, len(s.servers))
+	for _, server := range s.servers {
+		servers = append(servers, server)
+	}
+	s.mu.Unlock()
+
+	deadline := time.After(timeout)
+
+	for _, server := range servers {
+		select {
+		case <-server.done:
+		case <-deadline:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Supervisor) start(key string, serverConfig ServerConfig) {
+	logger := s.logger.With("server", key, "game", serverConfig.Game)
+
+	var err error
+
+	monitor, ok := s.monitors[serverConfig.Game]
+	if !ok {
+		// monitors live as long as supervisor, game wide settings are not reloaded
+		monitor, err = CreateMonitor(s.ctx, serverConfig.Game, s.config, s.logger)
+		if err == nil {
+			s.monitors[serverConfig.Game] = monitor
+		}
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	server := &runningServer{
+		poller: NewPoller(monitor, key, serverConfig, logger),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	server.poller.recorders = s.recorders
+	server.poller.stateFile = s.stateFile
+	server.poller.chart = s.chart
+	server.poller.baseLogger = s.logger
+	server.poller.directory = s
+	s.servers[key] = server
+
+	// server is kept as failed, so reports show the reason and next config change retries it
+	if err != nil {
+		logger.Error("Failed to create game monitor", "error", err)
+		server.setState(ServerState{State: StateFailed, Reason: fmt.Sprintf("failed to create game monitor: %v", err), Since: time.Now()})
+		cancel()
+		close(server.done)
+
+		return
+	}
+
+	logger.Info("Running server", "name", serverConfig.Name)
+
+	go s.supervise(ctx, monitor, server)
+}
+
+// supervise runs server monitor until ctx is done, restarting it after failures with exponential backoff
+func (s *Supervisor) supervise(ctx context.Context, monitor Monitor, server *runningServer) {
+	defer close(server.done)
+
+	settings := s.config.Supervisor
+	attempt, restarts := 0, 0
+
+	for {
+		server.setState(ServerState{State: StateRunning, Restarts: restarts, Since: time.Now()})
+
+		started := time.Now()
+		err := runMonitor(ctx, monitor, server.poller)
+		server.poller.SetBotState(BotDisconnected)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			err = errors.New("monitor stopped unexpectedly")
+		}
+
+		logger := server.poller.Logger()
+
+		// server which worked for a while is not failing in a row
+		if time.Since(started) > settings.maxBackoff() {
+			attempt = 0
+		}
+		attempt++
+
+		if IsPermanent(err) || (settings.MaxRestarts > 0 && attempt > settings.MaxRestarts) {
+			logger.Error("Server failed permanently", "error", err)
+			server.setState(ServerState{State: StateFailed, Reason: err.Error(), Restarts: restarts, Since: time.Now()})
+
+			return
+		}
+
+		delay := settings.Backoff(attempt)
+		logger.Warn("Server failed, restarting", "error", err, "delay", delay)
+		server.setState(ServerState{
+			State:    StateBackingOff,
+			Reason:   err.Error(),
+			Restarts: restarts,
+			Since:    time.Now(),
+			RetryAt:  time.Now().Add(delay),
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		restarts++
+	}
+}
+
+// runMonitor runs monitor once, panic is returned as an error
+func runMonitor(ctx context.Context, monitor Monitor, poller *Poller) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("monitor panic: %v", r))
+		}
+	}()
+
+	return monitor.Run(ctx, poller)
+}
+
+// stop removes and cancels server, caller waits for it with waitStopped after releasing the lock
+func (s *Supervisor) stop(key string) *runningServer {
+	server := s.servers[key]
+	delete(s.servers, key)
+
+	server.cancel()
+
+	return server
+}
+
+// waitStopped waits until bots of stopped servers are disconnected, so restarted bots don't overlap with them
+func waitStopped(servers []*runningServer, timeout time.Duration) {
+	for _, server := range servers {
+		select {
+		case <-server.done:
+		case <-time.After(timeout):
+			server.poller.Logger().Warn("Server didn't stop in time")
+		}
+	}
+}
+
+// State returns current lifecycle state of the server
+func (r *runningServer) State() ServerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state
+}
+
+func (r *runningServer) setState(state ServerState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state = state
+}
+
+// needsRestart reports whether server bot must be reconnected to apply new config
+func needsRestart(old ServerConfig, new ServerConfig) bool {
+	return old.Name != new.Name ||
+		old.Game != new.Game ||
+		old.BotToken != new.BotToken ||
+		old.BotID != new.BotID ||
+		old.Bot != new.Bot ||
+		old.CommandsEnabled() != new.CommandsEnabled()
+}
+
+// settingsChanged reports whether server settings applied without bot reconnect changed
+func settingsChanged(old ServerConfig, new ServerConfig) bool {
+	return !reflect.DeepEqual(old.Info, new.Info) ||
+		old.RefreshDelay != new.RefreshDelay ||
+		!reflect.DeepEqual(old.Presence, new.Presence) ||
+		old.Embed != new.Embed ||
+		old.Counter != new.Counter ||
+		!reflect.DeepEqual(old.Alerts, new.Alerts) ||
+		old.Debounce != new.Debounce ||
+		sharedBotChanged(old.SharedBot, new.SharedBot)
+}
+
+// sharedBotChanged reports whether shared bot settings applied without reconnect changed
+func sharedBotChanged(old *BotConfig, new *BotConfig) bool {
+	if old == nil || new == nil {
+		return old != new
+	}
+
+	return old.Presence != new.Presence || old.Embed != new.Embed
+}
+
+func globalSettingsChanged(old *Config, new *Config) bool {
+	oldGlobal, newGlobal := *old, *new
+	oldGlobal.Servers, newGlobal.Servers = nil, nil
+	oldGlobal.root, newGlobal.root = nil, nil
+	// global presence is merged into servers and reloaded with them
+	oldGlobal.Presence, newGlobal.Presence = PresenceConfig{}, PresenceConfig{}
+	// shared bots are copied into servers which use them
+	oldGlobal.Bots, newGlobal.Bots = nil, nil
+
+	return !reflect.DeepEqual(oldGlobal, newGlobal)
+}
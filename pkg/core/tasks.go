@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Tasks runs goroutines of a server run. Panic of a goroutine is recovered as an error and cancels context
+// of the tasks, so the run returns it and supervisor restarts only this server.
+type Tasks struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewTasks returns tasks and context of them which is canceled when a task panics
+func NewTasks(ctx context.Context) (*Tasks, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &Tasks{cancel: cancel}, ctx
+}
+
+// Go runs fn in a goroutine
+func (t *Tasks) Go(fn func()) {
+	t.wg.Add(1)
+
+	go func() {
+		defer t.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				t.fail(errors.New(fmt.Sprintf("goroutine panic: %v", r)))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Wait waits for all tasks and returns error of the first panic, context of the tasks is canceled after it
+func (t *Tasks) Wait() error {
+	t.wg.Wait()
+	t.cancel()
+
+	return t.Err()
+}
+
+// Err returns error of the first panic without waiting for tasks, nil if none of them panicked
+func (t *Tasks) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+func (t *Tasks) fail(err error) {
+	t.mu.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.mu.Unlock()
+
+	t.cancel()
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTasksPanic(t *testing.T) {
+	tasks, ctx := NewTasks(context.Background())
+
+	tasks.Go(func() { <-ctx.Done() })
+	tasks.Go(func() { panic("boom") })
+
+	done := make(chan error)
+	go func() { done <- tasks.Wait() }()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("Wait() = %v, want panic error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic did not cancel other tasks")
+	}
+}
+
+func TestTasksNoPanic(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	tasks, ctx := NewTasks(parent)
+
+	tasks.Go(func() { <-ctx.Done() })
+	cancel()
+
+	if err := tasks.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+	if err := tasks.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
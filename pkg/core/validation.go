@@ -0,0 +1,492 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InfoValidator is implemented by game info structs
+type InfoValidator interface {
+	// Validate returns invalid fields of decoded info section
+	Validate() []FieldError
+}
+
+// FieldError describes invalid config value, Field is a yaml key or dot separated path of keys
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidateAddress checks required "host:port" address field
+func ValidateAddress(field string, addr string) []FieldError {
+	if addr == "" {
+		return []FieldError{{Field: field, Message: "address with port is required"}}
+	}
+
+	_, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []FieldError{{Field: field, Message: fmt.Sprintf("invalid address %q, expected host:port", addr)}}
+	}
+
+	return nil
+}
+
+var webhookURL = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/api(?:/v\d+)?/webhooks/(\d+)/[\w-]+$`)
+
+// ParseWebhookURL returns id of discord webhook url, false if url is not a webhook url
+func ParseWebhookURL(rawURL string) (string, bool) {
+	match := webhookURL.FindStringSubmatch(rawURL)
+	if match == nil {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+// ConfigError is a single config problem, Line is 0 if it is unknown
+type ConfigError struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	var b strings.Builder
+
+	if e.Line > 0 {
+		b.WriteString(fmt.Sprintf("line %d: ", e.Line))
+	}
+
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+
+	b.WriteString(e.Message)
+
+	return b.String()
+}
+
+// ConfigErrors is a list of all problems found in config
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+
+	return fmt.Sprintf("invalid config:\n%s", strings.Join(lines, "\n"))
+}
+
+// validate checks enabled servers, decodes their typed game info and applies defaults
+func (c *Config) validate() ConfigErrors {
+	var errs ConfigErrors
+
+	keys := make([]string, 0, len(c.Servers))
+	for key := range c.Servers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if _, ok := parseLogLevel(c.Log.Level); !ok {
+		errs = append(errs, c.fieldError("log.level", fmt.Sprintf("unknown log level %q, available: debug, info, warn, error", c.Log.Level)))
+	}
+	if format := strings.ToLower(c.Log.Format); format != "" && format != LogFormatText && format != LogFormatJSON {
+		errs = append(errs, c.fieldError("log.format", fmt.Sprintf("unknown log format %q, available: %s, %s", c.Log.Format, LogFormatText, LogFormatJSON)))
+	}
+	if c.Log.MaxSize < 0 || c.Log.MaxBackups < 0 || c.Log.MaxAge < 0 {
+		errs = append(errs, c.fieldError("log", "maxSize, maxBackups and maxAge can not be negative"))
+	}
+
+	if c.History.RawRetention < 0 || c.History.HourlyRetention < 0 {
+		errs = append(errs, c.fieldError("history", "rawRetention and hourlyRetention can not be negative"))
+	}
+
+	if c.Supervisor.InitialBackoff < 0 {
+		errs = append(errs, c.fieldError("supervisor.initialBackoff", "must be a positive number of seconds"))
+	}
+	if c.Supervisor.MaxBackoff < 0 {
+		errs = append(errs, c.fieldError("supervisor.maxBackoff", "must be a positive number of seconds"))
+	}
+	if c.Supervisor.MaxRestarts < 0 {
+		errs = append(errs, c.fieldError("supervisor.maxRestarts", "must be a positive number, 0 - unlimited"))
+	}
+
+	// global presence errors are reported once, servers report only fields they override
+	globalPresence := c.Presence.merge(defaultPresence)
+	_, presenceErrs := compilePresence(globalPresence)
+	for _, fieldErr := range presenceErrs {
+		errs = append(errs, c.fieldError("presence."+fieldErr.Field, fieldErr.Message))
+	}
+
+	botNames := make([]string, 0, len(c.Bots))
+	for name := range c.Bots {
+		botNames = append(botNames, name)
+	}
+	sort.Strings(botNames)
+
+	for _, name := range botNames {
+		bot := c.Bots[name]
+
+		botErr := func(field string, message string) {
+			errs = append(errs, c.fieldError("bots."+name+"."+field, message))
+		}
+
+		if bot.BotID == "" || bot.BotToken == "" {
+			botErr("botToken", "botToken and botID are required")
+		}
+
+		if bot.Embed.ChannelID != "" {
+			if _, err := strconv.ParseUint(bot.Embed.ChannelID, 10, 64); err != nil {
+				botErr("embed.channelID", "must be a discord channel id")
+			}
+		}
+
+		if bot.Embed.Webhook != "" {
+			if _, ok := ParseWebhookURL(bot.Embed.Webhook); !ok {
+				botErr("embed.webhook", "must be a discord webhook url https://discord.com/api/webhooks/{id}/{token}")
+			}
+
+			if bot.Embed.ChannelID != "" {
+				botErr("embed", "set either channelID or webhook")
+			}
+		}
+
+		var botPresenceErrs []FieldError
+		bot.Presence = bot.Presence.merge(defaultGroupPresence)
+		bot.CompiledPresence, botPresenceErrs = compileGroupPresence(bot.Presence)
+		for _, fieldErr := range botPresenceErrs {
+			botErr("presence."+fieldErr.Field, fieldErr.Message)
+		}
+
+		c.Bots[name] = bot
+	}
+
+	usedGames := make(map[string]bool)
+
+	for _, key := range keys {
+		server := c.Servers[key]
+		if !server.Enabled {
+			continue
+		}
+
+		serverErr := func(field string, message string) {
+			errs = append(errs, c.fieldError("servers."+key+"."+field, message))
+		}
+
+		if server.Bot != "" {
+			bot, ok := c.Bots[server.Bot]
+
+			switch {
+			case !ok:
+				serverErr("bot", fmt.Sprintf("unknown bot %q, bots are set in bots section", server.Bot))
+			case server.BotToken != "" || server.BotID != "":
+				serverErr("bot", "set either bot or botToken and botID")
+			default:
+				server.BotToken, server.BotID, server.SharedBot = bot.BotToken, bot.BotID, &bot
+			}
+
+			if server.Commands {
+				serverErr("commands", "commands of shared bot are set in bots section")
+			}
+		}
+
+		if server.Bot == "" && (server.BotID == "" || server.BotToken == "") && !server.WebhookOnly() {
+			serverErr("botToken", "botToken and botID are required, unless server has only embed.webhook")
+		}
+
+		if server.RefreshDelay < 0 {
+			serverErr("refreshDelay", "must be a positive number of seconds")
+		} else if server.RefreshDelay == 0 {
+			server.RefreshDelay = DefaultRefreshDelay
+		}
+
+		if server.Embed.ChannelID != "" {
+			if _, err := strconv.ParseUint(server.Embed.ChannelID, 10, 64); err != nil {
+				serverErr("embed.channelID", "must be a discord channel id")
+			}
+		}
+
+		if server.Debounce.OfflineAfter < 0 || server.Debounce.OnlineAfter < 0 {
+			serverErr("debounce", "offlineAfter and onlineAfter can not be negative")
+		}
+
+		if server.Embed.Webhook != "" {
+			if _, ok := ParseWebhookURL(server.Embed.Webhook); !ok {
+				serverErr("embed.webhook", "must be a discord webhook url https://discord.com/api/webhooks/{id}/{token}")
+			}
+
+			if server.Embed.ChannelID != "" {
+				serverErr("embed", "set either channelID or webhook")
+			}
+		}
+
+		if server.WebhookOnly() && (server.Commands || server.Counter.ChannelID != "" || server.Alerts.ChannelID != "") {
+			serverErr("botToken", "commands, counter and alerts require botToken and botID")
+		}
+
+		if server.Alerts.ChannelID != "" {
+			if _, err := strconv.ParseUint(server.Alerts.ChannelID, 10, 64); err != nil {
+				serverErr("alerts.channelID", "must be a discord channel id")
+			}
+		}
+
+		if server.Alerts.RoleID != "" {
+			if _, err := strconv.ParseUint(server.Alerts.RoleID, 10, 64); err != nil {
+				serverErr("alerts.roleID", "must be a discord role id")
+			}
+		}
+
+		for i, event := range server.Alerts.Events {
+			if !slices.Contains(alertEvents, strings.ToLower(event)) {
+				serverErr(fmt.Sprintf("alerts.events.%d", i),
+					fmt.Sprintf("unknown event %q, available: %s", event, strings.Join(alertEvents, ", ")))
+			}
+		}
+
+		if server.Alerts.Cooldown < 0 {
+			serverErr("alerts.cooldown", "must be a positive number of seconds")
+		}
+
+		if server.Counter.ChannelID != "" {
+			if _, err := strconv.ParseUint(server.Counter.ChannelID, 10, 64); err != nil {
+				serverErr("counter.channelID", "must be a discord channel id")
+			}
+
+			var counterErrs []FieldError
+			server.CompiledCounter, counterErrs = compileCounter(server.Counter)
+			for _, fieldErr := range counterErrs {
+				serverErr("counter."+fieldErr.Field, fieldErr.Message)
+			}
+		}
+
+		overrides := server.Presence
+		server.Presence = overrides.merge(globalPresence)
+
+		var serverPresenceErrs []FieldError
+		server.CompiledPresence, serverPresenceErrs = compilePresence(server.Presence)
+		for _, fieldErr := range serverPresenceErrs {
+			if overrides.overrides(fieldErr.Field) {
+				serverErr("presence."+fieldErr.Field, fieldErr.Message)
+			}
+		}
+
+		game, ok := GetGame(server.Game)
+		if !ok {
+			serverErr("game", fmt.Sprintf("unknown game %q, available: %v", server.Game, Games()))
+			continue
+		}
+
+		usedGames[server.Game] = true
+
+		info, infoErrs := c.decodeInfo(game, &server.InfoNode, "servers."+key+".info")
+		errs = append(errs, infoErrs...)
+
+		server.Info = info
+		c.Servers[key] = server
+	}
+
+	for _, key := range Games() {
+		game, _ := GetGame(key)
+		if !usedGames[key] || game.Validate == nil {
+			continue
+		}
+
+		for _, fieldErr := range game.Validate(c) {
+			errs = append(errs, c.fieldError(fieldErr.Field, fieldErr.Message))
+		}
+	}
+
+	return errs
+}
+
+// decodeInfo decodes and validates info section of the game server, path is used for error messages
+func (c *Config) decodeInfo(game Game, node *yaml.Node, path string) (InfoValidator, ConfigErrors) {
+	var errs ConfigErrors
+
+	info := game.NewInfo()
+
+	if !node.IsZero() {
+		err := node.Decode(info)
+		if err != nil {
+			typeErr, ok := err.(*yaml.TypeError)
+			if !ok {
+				return info, append(errs, c.fieldError(path, err.Error()))
+			}
+
+			errs = append(errs, typeErrors(typeErr, path)...)
+		}
+
+		// decoding ignores unknown keys, so misspelled options are reported here
+		fields := yamlFields(reflect.TypeOf(info))
+		for _, key := range unknownKeys(node, fields) {
+			errs = append(errs, c.fieldError(path+"."+key, fmt.Sprintf("unknown field, available: %s", strings.Join(fields, ", "))))
+		}
+	}
+
+	for _, fieldErr := range info.Validate() {
+		errs = append(errs, c.fieldError(path+"."+fieldErr.Field, fieldErr.Message))
+	}
+
+	return info, errs
+}
+
+// NewServerConfig builds enabled server config of the game outside of config file, used for one-shot queries.
+// Info values are parsed the same way as plain yaml scalars.
+func NewServerConfig(config *Config, gameKey string, name string, info map[string]string) (ServerConfig, error) {
+	game, ok := GetGame(gameKey)
+	if !ok {
+		return ServerConfig{}, errors.New(fmt.Sprintf("unknown game %q, available: %v", gameKey, Games()))
+	}
+
+	node := yaml.Node{Kind: yaml.MappingNode}
+
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: info[key]})
+	}
+
+	decoded, errs := config.decodeInfo(game, &node, "info")
+
+	if game.Validate != nil {
+		for _, fieldErr := range game.Validate(config) {
+			errs = append(errs, config.fieldError(fieldErr.Field, fieldErr.Message))
+		}
+	}
+
+	if len(errs) > 0 {
+		return ServerConfig{}, errs
+	}
+
+	return ServerConfig{
+		Name:         name,
+		Game:         gameKey,
+		RefreshDelay: DefaultRefreshDelay,
+		Enabled:      true,
+		InfoNode:     node,
+		Info:         decoded,
+	}, nil
+}
+
+// fieldError points error to the line of the deepest existing key of the path
+func (c *Config) fieldError(path string, message string) ConfigError {
+	line := 0
+
+	if c.root != nil {
+		node := c.root
+		if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+			node = node.Content[0]
+		}
+
+		for _, key := range strings.Split(path, ".") {
+			keyNode, valueNode := mappingValue(node, key)
+			if keyNode == nil {
+				break
+			}
+
+			line = keyNode.Line
+			node = valueNode
+		}
+	}
+
+	return ConfigError{Line: line, Path: path, Message: message}
+}
+
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// yamlFields returns yaml keys of struct fields, inline structs are included
+func yamlFields(t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+
+		switch {
+		case name == "-":
+			continue
+		case options == "inline":
+			fields = append(fields, yamlFields(field.Type)...)
+			continue
+		case name == "":
+			name = strings.ToLower(field.Name)
+		}
+
+		fields = append(fields, name)
+	}
+
+	return fields
+}
+
+// unknownKeys returns keys of mapping node which are not in fields
+func unknownKeys(node *yaml.Node, fields []string) []string {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var unknown []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i].Value; !slices.Contains(fields, key) {
+			unknown = append(unknown, key)
+		}
+	}
+
+	return unknown
+}
+
+// typeErrors converts yaml "line N: message" errors
+func typeErrors(err *yaml.TypeError, path string) ConfigErrors {
+	errs := make(ConfigErrors, 0, len(err.Errors))
+
+	for _, msg := range err.Errors {
+		var line int
+		_, scanErr := fmt.Sscanf(msg, "line %d:", &line)
+		if scanErr == nil {
+			msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+		}
+
+		errs = append(errs, ConfigError{Line: line, Path: path, Message: msg})
+	}
+
+	return errs
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testInfo struct {
+	Addr    string `yaml:"addr"`
+	Verbose bool   `yaml:"verbose"`
+}
+
+func (i *testInfo) Validate() []FieldError {
+	return ValidateAddress("addr", i.Addr)
+}
+
+func init() {
+	RegisterGame("test", Game{
+		CreateMonitor: func(ctx context.Context, config *Config, logger *slog.Logger) (Monitor, error) {
+			return nil, errors.New("test game has no monitor")
+		},
+		NewInfo: func() InfoValidator {
+			return &testInfo{}
+		},
+		AddressField: "addr",
+	})
+}
+
+// parseTestConfig writes yaml to a temporary file and parses it
+func parseTestConfig(t *testing.T, text string) (*Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return ParseConfig(path)
+}
+
+func TestConfigErrorLines(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []ConfigError
+	}{
+		{
+			name: "valid",
+			yaml: `
+servers:
+  a:
+    game: test
+    botToken: x
+    botID: "1"
+    enabled: true
+    info:
+      addr: "127.0.0.1:1"
+`,
+		},
+		{
+			name: "nested info keys",
+			yaml: `
+servers:
+  a:
+    game: test
+    botToken: x
+    botID: "1"
+    enabled: true
+    info:
+      addr: "127.0.0.1"
+      refreshDelay: 5
+`,
+			want: []ConfigError{
+				{Line: 10, Path: "servers.a.info.refreshDelay"},
+				{Line: 9, Path: "servers.a.info.addr"},
+			},
+		},
+		{
+			name: "missing key points to its parent",
+			yaml: `
+servers:
+  a:
+    game: test
+    enabled: true
+    info:
+      addr: "127.0.0.1:1"
+`,
+			want: []ConfigError{{Line: 3, Path: "servers.a.botToken"}},
+		},
+		{
+			name: "nested presence and list item",
+			yaml: `
+servers:
+  a:
+    game: test
+    botToken: x
+    botID: "1"
+    enabled: true
+    info:
+      addr: "127.0.0.1:1"
+    alerts:
+      events:
+        - down
+        - sideways
+    presence:
+      online: "{{.Nope}}"
+`,
+			want: []ConfigError{
+				{Line: 11, Path: "servers.a.alerts.events.1"},
+				{Line: 15, Path: "servers.a.presence.online"},
+			},
+		},
+		{
+			name: "type error",
+			yaml: `
+servers:
+  a:
+    game: test
+    botToken: x
+    botID: "1"
+    enabled: true
+    refreshDelay: soon
+    info:
+      addr: "127.0.0.1:1"
+`,
+			want: []ConfigError{{Line: 8}},
+		},
+		{
+			name: "disabled server is not validated",
+			yaml: `
+servers:
+  a:
+    game: unknown
+    enabled: false
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseTestConfig(t, test.yaml)
+
+			var errs ConfigErrors
+			if err != nil && !errors.As(err, &errs) {
+				t.Fatalf("ParseConfig() error = %v, want ConfigErrors", err)
+			}
+
+			if len(errs) != len(test.want) {
+				t.Fatalf("ParseConfig() errors = %v, want %d errors", errs, len(test.want))
+			}
+
+			for i, want := range test.want {
+				if errs[i].Line != want.Line || want.Path != "" && errs[i].Path != want.Path {
+					t.Errorf("error %d = line %d %s, want line %d %s", i, errs[i].Line, errs[i].Path, want.Line, want.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigErrorString(t *testing.T) {
+	tests := []struct {
+		err  ConfigError
+		want string
+	}{
+		{ConfigError{Line: 3, Path: "servers.a.game", Message: "unknown game"}, "line 3: servers.a.game: unknown game"},
+		{ConfigError{Path: "servers.a.game", Message: "unknown game"}, "servers.a.game: unknown game"},
+		{ConfigError{Message: "bad yaml"}, "bad yaml"},
+	}
+
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+}
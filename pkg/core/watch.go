@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+// watchDebounce merges bursts of file events, editors often write a file in several steps
+const watchDebounce = 500 * time.Millisecond
+
+// WatchConfig notifies about config file changes until ctx is done.
+// Directory of the file is watched, so file replacement by editors is noticed too.
+func WatchConfig(ctx context.Context, path string, logger *slog.Logger) (<-chan struct{}, error) {
+	filename, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	err = watcher.Add(filepath.Dir(filename))
+	if err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) == filename && !event.Has(fsnotify.Chmod) {
+					debounce = time.After(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				logger.Warn("Config watcher error", "error", err)
+			case <-debounce:
+				debounce = nil
+
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,123 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"fmt"
+	"github.com/andersfylling/disgord"
+	"unicode/utf8"
+)
+
+const (
+	colorFull  = 0xfaa61a
+	colorEmpty = 0x747f8d
+)
+
+// runAlerts posts alerts of server state changes until ctx is done, state known before start is not alerted
+func (b *Bot) runAlerts(ctx context.Context) {
+	listener, status := b.poller.Subscribe()
+	defer listener.Close()
+
+	var tracker core.AlertTracker
+
+	for {
+		if status != nil {
+			// tracker follows state even while alerts are disabled, so enabling them doesn't alert old changes
+			config := b.poller.Config().Alerts
+			_, lastErr := b.poller.Last()
+			_, lastSuccess := b.poller.LastQuery()
+
+			for _, alert := range tracker.Update(config, status, lastErr, lastSuccess) {
+				if config.ChannelID != "" {
+					b.sendAlert(config, alert)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case status = <-listener.Ch():
+		}
+	}
+}
+
+func (b *Bot) sendAlert(config core.AlertsConfig, alert core.Alert) {
+	message := GetAlertMessage(b.poller.Config().Name, alert, config.RoleID)
+
+	if b.dryRun {
+		b.logger.Info("Dry run: discord alert is not sent", "channel", config.ChannelID, "alert", alert.Event)
+		return
+	}
+
+	_, err := b.Client.Channel(disgord.ParseSnowflakeString(config.ChannelID)).CreateMessage(message)
+	if err != nil {
+		b.logger.Warn("Failed to send discord alert", "channel", config.ChannelID, "alert", alert.Event, "error", err)
+		return
+	}
+
+	b.logger.Debug("Discord alert sent", "alert", alert.Event)
+}
+
+// GetAlertMessage builds alert message of server state change, role is mentioned if roleID is set
+func GetAlertMessage(serverName string, alert core.Alert, roleID string) *disgord.CreateMessage {
+	embed := &disgord.Embed{}
+
+	switch alert.Event {
+	case core.AlertDown:
+		embed.Title, embed.Color = fmt.Sprintf("%s is down", serverName), colorOffline
+
+		if alert.LastError != nil {
+			embed.Fields = append(embed.Fields,
+				&disgord.EmbedField{Name: "Last error", Value: truncate(alert.LastError.Error(), maxFieldLength)},
+				&disgord.EmbedField{Name: "Error type", Value: core.ClassifyError(alert.LastError), Inline: true},
+			)
+		}
+	case core.AlertUp:
+		embed.Title, embed.Color = fmt.Sprintf("%s is back online", serverName), colorOnline
+		embed.Fields = append(embed.Fields, &disgord.EmbedField{
+			Name:   "Downtime",
+			Value:  formatDuration(alert.Downtime),
+			Inline: true,
+		})
+	case core.AlertFull:
+		embed.Title, embed.Color = fmt.Sprintf("%s is full", serverName), colorFull
+	case core.AlertEmpty:
+		embed.Title, embed.Color = fmt.Sprintf("%s is empty", serverName), colorEmpty
+	}
+
+	if alert.Status != nil && alert.Status.Online {
+		embed.Fields = append(embed.Fields, &disgord.EmbedField{
+			Name:   "Players",
+			Value:  fmt.Sprintf("%d/%d", alert.Status.Players, alert.Status.MaxPlayers),
+			Inline: true,
+		})
+	}
+
+	message := &disgord.CreateMessage{
+		Embeds: []*disgord.Embed{embed},
+		// only configured role is mentioned, error texts can't ping anyone
+		AllowedMentions: &disgord.AllowedMentions{Parse: []string{}},
+	}
+
+	if roleID != "" {
+		message.Content = fmt.Sprintf("<@&%s>", roleID)
+		message.AllowedMentions.Roles = []disgord.Snowflake{disgord.ParseSnowflakeString(roleID)}
+	}
+
+	return message
+}
+
+// truncate cuts text to limit of bytes without breaking runes
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+
+	cut := limit - len("...")
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+
+	return text[:cut] + "..."
+}
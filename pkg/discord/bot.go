@@ -2,77 +2,488 @@ package discord
 
 import (
 	"DiscordMBM/pkg/core"
+	"DiscordMBM/pkg/metrics"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/andersfylling/disgord"
+	"log/slog"
+	"sync"
+	"time"
 )
 
 type Bot struct {
-	Client *disgord.Client
+	Client       *disgord.Client
+	ServerConfig core.ServerConfig
+
+	logger           *slog.Logger
+	shutdownPresence string
+	// dryRun bots don't connect to discord and only log their presence, Client is nil then
+	dryRun bool
+	// webhookOnly bots have no discord client and only update status message through webhook
+	webhookOnly bool
+	// members are servers shown by shared bot, it is set only on the bot connected by group
+	members *group
+
+	// poller is set by Serve
+	poller *core.Poller
+	// resend asks presence loop to send the current presence again after reconnect
+	resend chan struct{}
+	// embed is a status message, it is used only by embed loop
+	embed embedMessage
+	// registerCommands registers slash commands on the first ready event
+	registerCommands sync.Once
+
+	mu        sync.Mutex
+	connected bool
+	// connects counts ready and resumed events, every event after the first one is a reconnect
+	connects int
 }
 
-func InitBot(srvConfig core.ServerConfig) (*Bot, error) {
-	if srvConfig.BotID == "" || srvConfig.BotToken == "" {
-		return nil, errors.New(fmt.Sprintf("discord bot id or token can not be empty, server: %s", srvConfig.Name))
+// InitBot creates discord client of server bot, ctx limits bot details request made by client.
+// Server with webhook only gets bot without client, server with shared bot gets its client when it is served.
+func InitBot(ctx context.Context, config *core.Config, srvConfig core.ServerConfig, logger *slog.Logger) (*Bot, error) {
+	if (srvConfig.BotID == "" || srvConfig.BotToken == "") && !srvConfig.WebhookOnly() {
+		return nil, core.Permanent(errors.New(fmt.Sprintf("discord bot id or token can not be empty, server: %s", srvConfig.Name)))
 	}
 
 	bot := &Bot{
-		Client: disgord.New(disgord.Config{
+		ServerConfig:     srvConfig,
+		logger:           logger,
+		shutdownPresence: config.ShutdownPresence,
+		dryRun:           config.DryRun,
+		resend:           make(chan struct{}, 1),
+		webhookOnly:      srvConfig.WebhookOnly(),
+	}
+
+	if !bot.dryRun && !bot.webhookOnly && srvConfig.SharedBot == nil {
+		client, err := disgord.NewClient(ctx, disgord.Config{
 			BotToken:     srvConfig.BotToken,
 			ProjectName:  srvConfig.Name,
 			DisableCache: true,
-		}),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		bot.Client = client
 	}
 
 	return bot, nil
 }
 
-func GetServerStatusPayload(isOnline bool, players string, maxPlayers string, gameMap *string) *disgord.UpdateStatusPayload {
-	var payload disgord.UpdateStatusPayload
+// RunServer sets up bot of the server and serves it while poll publishes statuses of the server to poller.
+// Panic of poll fails the run, poll is canceled and waited for before return, so a restarted run doesn't overlap it.
+func RunServer(ctx context.Context, config *core.Config, poller *core.Poller, poll func(ctx context.Context)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bot, err := InitBot(ctx, config, poller.Config(), poller.Logger())
+	if err != nil {
+		return fmt.Errorf("failed to set up discord bot. Details: %w", err)
+	}
+
+	tasks, tasksCtx := core.NewTasks(ctx)
+	tasks.Go(func() { poll(tasksCtx) })
+
+	err = bot.Serve(tasksCtx, poller)
+	cancel()
+
+	if panicErr := tasks.Wait(); panicErr != nil {
+		return panicErr
+	}
+
+	return err
+}
+
+// Presence updates of a bot are limited to presenceBurst per presenceWindow and minPresenceGap apart,
+// discord drops too frequent updates
+const (
+	minPresenceGap = 5 * time.Second
+	presenceBurst  = 5
+	presenceWindow = time.Minute
+	// presenceKeepalive is a time after which unchanged presence is sent again
+	presenceKeepalive = 10 * time.Minute
+)
+
+// Serve connects bot to discord and keeps its presence and status message in sync with poller statuses
+// until ctx is done. Polling is not bound to the gateway, reconnects only push the latest known status again.
+func (b *Bot) Serve(ctx context.Context, poller *core.Poller) error {
+	b.poller = poller
+
+	if b.webhookOnly {
+		poller.SetBotState(core.BotWebhook)
+
+		b.runEmbed(ctx)
+
+		return nil
+	}
+
+	if b.ServerConfig.SharedBot != nil {
+		return b.serveShared(ctx)
+	}
+
+	listener, _ := poller.Subscribe()
+	defer listener.Close()
+
+	if b.dryRun {
+		poller.SetBotState(core.BotDryRun)
+
+		return b.runOutputs(ctx, func(ctx context.Context) {
+			b.runPresence(ctx, listener.Ch(), serverPresence{b}, b.logDryRun)
+		})
+	}
+
+	err := b.connect(ctx, poller.Config().Commands)
+	if err != nil {
+		return err
+	}
+
+	err = b.runOutputs(ctx, func(ctx context.Context) {
+		b.runPresence(ctx, listener.Ch(), serverPresence{b}, b.updatePresence)
+	})
+
+	disconnectErr := b.disconnect()
+	if err != nil {
+		return err
+	}
+
+	return disconnectErr
+}
+
+// connect connects bot to discord gateway, presence is pushed again on every ready and resumed event
+func (b *Bot) connect(ctx context.Context, commandsEnabled bool) error {
+	onConnect := func() {
+		b.logger.Debug("Discord bot connected")
+
+		b.mu.Lock()
+		b.connected = true
+		b.connects++
+		if b.connects > 1 {
+			metrics.GatewayReconnected(b.key())
+		}
+		b.mu.Unlock()
+
+		b.setBotState(core.BotConnected)
+
+		select {
+		case b.resend <- struct{}{}:
+		default:
+		}
+	}
+
+	b.Client.Gateway().Ready(func(s disgord.Session, h *disgord.Ready) {
+		onConnect()
+
+		if commandsEnabled {
+			b.registerCommands.Do(func() {
+				go b.createCommands(h.Application.ID)
+			})
+		}
+	})
+
+	b.Client.Gateway().Resumed(func(s disgord.Session, h *disgord.Resumed) {
+		onConnect()
+	})
+
+	if commandsEnabled {
+		b.Client.Gateway().InteractionCreate(b.onInteraction)
+	}
+
+	b.setBotState(core.BotConnecting)
+
+	return b.Client.Gateway().WithContext(ctx).Connect()
+}
+
+// disconnect shows shutdown presence and disconnects bot from discord gateway
+func (b *Bot) disconnect() error {
+	if b.shutdownPresence != "" {
+		b.updatePresence(GetShutdownPayload(b.shutdownPresence))
+	}
+
+	b.mu.Lock()
+	b.connected = false
+	b.mu.Unlock()
+
+	b.setBotState(core.BotDisconnected)
+
+	return b.Client.Gateway().Disconnect()
+}
+
+// key identifies bot in metrics, shared bot is labeled by its name
+func (b *Bot) key() string {
+	if b.members != nil {
+		return "bot:" + b.members.name
+	}
+
+	return b.poller.Key
+}
+
+// setBotState reports connection state of the bot, shared bot reports it to all its servers
+func (b *Bot) setBotState(state string) {
+	if b.members != nil {
+		b.members.setBotState(state)
+		return
+	}
+
+	b.poller.SetBotState(state)
+}
+
+// runOutputs runs status message, counter channel and alert loops with extra loops until ctx is done.
+// Panic of a loop stops all of them and is returned as an error.
+func (b *Bot) runOutputs(ctx context.Context, loops ...func(ctx context.Context)) error {
+	tasks, ctx := core.NewTasks(ctx)
+
+	for _, run := range append([]func(ctx context.Context){b.runEmbed, b.runCounter, b.runAlerts}, loops...) {
+		run := run
+		tasks.Go(func() { run(ctx) })
+	}
+
+	return tasks.Wait()
+}
+
+// presenceSource renders presence shown by a bot
+type presenceSource interface {
+	// steps returns number of presence texts rotated and rotation interval, 0 steps - nothing to show yet
+	steps() (int, time.Duration)
+	// payload renders presence at rotation step, nil is returned if there is nothing to show
+	payload(step int) *disgord.UpdateStatusPayload
+}
+
+// runPresence sends presence on updates, reconnects and rotation steps until ctx is done.
+// Presence equal to the sent one is skipped unless bot reconnected or keepalive time passed.
+// Updates over rate limit are delayed, only the latest presence is sent then.
+func (b *Bot) runPresence(ctx context.Context, updates <-chan *core.ServerStatus, source presenceSource,
+	send func(payload *disgord.UpdateStatusPayload) bool) {
+	limiter := rateLimiter{limit: presenceBurst, window: presenceWindow, gap: minPresenceGap}
+
+	var lastKey string
+	var throttle, rotate, keepalive <-chan time.Time
 
-	var activities [1]disgord.Activity
+	step := 0
+	pending, force := true, false
 
-	if !isOnline {
-		activities[0] = disgord.Activity{
-			Name: "offline",
-			Type: 3,
+	for {
+		// rotation timer runs only while there is more than one text to show
+		if steps, interval := source.steps(); rotate == nil && steps > 1 {
+			rotate = time.After(interval)
 		}
 
-		payload = disgord.UpdateStatusPayload{
-			AFK:    true,
-			Game:   activities,
-			Status: disgord.StatusDnd,
+		if keepalive == nil && !limiter.last().IsZero() {
+			keepalive = time.After(presenceKeepalive - time.Since(limiter.last()))
 		}
-	} else {
-		var botStatus string
-		var afk bool
-
-		if players == "0" {
-			botStatus = disgord.StatusIdle
-			afk = true
-		} else {
-			afk = false
-			botStatus = disgord.StatusOnline
+
+		if pending && throttle == nil {
+			payload := source.payload(step)
+			wait := limiter.wait()
+
+			switch {
+			case payload == nil:
+				pending = false
+			case !force && presenceKey(payload) == lastKey:
+				metrics.PresenceSkipped(b.key())
+				pending = false
+			case wait > 0:
+				throttle = time.After(wait)
+			default:
+				if send(payload) {
+					lastKey = presenceKey(payload)
+				}
+				limiter.record()
+				keepalive, pending, force = nil, false, false
+			}
 		}
 
-		var name string
-		if gameMap == nil {
-			name = fmt.Sprintf("%s/%s", players, maxPlayers)
-		} else {
-			name = fmt.Sprintf("%s/%s on %s", players, maxPlayers, *gameMap)
+		select {
+		case <-ctx.Done():
+			return
+		case <-updates:
+			pending = true
+		case <-b.resend:
+			pending, force = true, true
+		case <-rotate:
+			rotate = nil
+			step++
+			pending = true
+		case <-keepalive:
+			keepalive = nil
+			pending, force = true, true
+		case <-throttle:
+			throttle = nil
 		}
+	}
+}
+
+// serverPresence is a presence of a single server bot
+type serverPresence struct {
+	bot *Bot
+}
+
+func (p serverPresence) steps() (int, time.Duration) {
+	status, _ := p.bot.poller.Last()
+	if status == nil {
+		return 0, 0
+	}
+
+	presence := p.bot.poller.Config().CompiledPresence
+
+	return presence.Steps(p.bot.presenceData(status)), presence.RotationInterval
+}
+
+// payload renders presence of the latest status, nil is returned if template fails
+func (p serverPresence) payload(step int) *disgord.UpdateStatusPayload {
+	status, _ := p.bot.poller.Last()
+	if status == nil {
+		return nil
+	}
 
-		activities[0] = disgord.Activity{
-			Name: name,
-			Type: 0,
+	payload, err := GetServerStatusPayload(p.bot.poller.Config().CompiledPresence, p.bot.presenceData(status), step)
+	if err != nil {
+		p.bot.logger.Warn("Failed to render bot presence", "error", err)
+	}
+
+	return payload
+}
+
+func (b *Bot) presenceData(status *core.ServerStatus) core.PresenceData {
+	return presenceData(b.poller, status)
+}
+
+// presenceData returns template data of server status
+func presenceData(poller *core.Poller, status *core.ServerStatus) core.PresenceData {
+	serverConfig := poller.Config()
+	mapDisplayer, ok := serverConfig.Info.(core.MapDisplayer)
+
+	data := core.PresenceData{
+		ServerName: serverConfig.Name,
+		ShowMap:    ok && mapDisplayer.ShowMap(),
+		Peak:       poller.PeakToday(),
+	}
+	if status != nil {
+		data.ServerStatus = *status
+	}
+
+	return data
+}
+
+// updatePresence sends presence to discord, false is returned if bot is disconnected or update failed.
+// Lock is not held while sending, so a slow gateway doesn't block connection events.
+func (b *Bot) updatePresence(payload *disgord.UpdateStatusPayload) bool {
+	b.mu.Lock()
+	connected, connects := b.connected, b.connects
+	b.mu.Unlock()
+
+	if !connected {
+		return false
+	}
+
+	err := b.Client.UpdateStatus(payload)
+	metrics.PresenceUpdated(b.key(), err)
+	if err != nil {
+		b.logger.Warn("Failed to update discord bot presence", "error", err)
+
+		// wait for the next ready or resumed event before pushing presence again,
+		// bot which reconnected while presence was sent stays connected
+		b.mu.Lock()
+		reconnected := b.connects != connects
+		if !reconnected {
+			b.connected = false
 		}
+		b.mu.Unlock()
 
-		payload = disgord.UpdateStatusPayload{
-			AFK:    afk,
-			Game:   activities,
-			Status: botStatus,
+		if !reconnected {
+			b.setBotState(core.BotDisconnected)
 		}
+
+		return false
+	}
+
+	return true
+}
+
+func (b *Bot) logDryRun(payload *disgord.UpdateStatusPayload) bool {
+	b.logger.Info("Dry run: discord bot presence is not sent", "presence", presenceText(payload))
+
+	return true
+}
+
+// presenceKey identifies presence shown to members, equal presences are not sent twice
+func presenceKey(payload *disgord.UpdateStatusPayload) string {
+	activities, ok := payload.Game.([1]disgord.Activity)
+	if !ok {
+		return presenceText(payload)
+	}
+
+	return fmt.Sprintf("%d %s", activities[0].Type, presenceText(payload))
+}
+
+func presenceText(payload *disgord.UpdateStatusPayload) string {
+	activities, ok := payload.Game.([1]disgord.Activity)
+	if !ok {
+		return payload.Status
+	}
+
+	if activities[0].State != "" {
+		return fmt.Sprintf("%s: %s", payload.Status, activities[0].State)
+	}
+
+	return fmt.Sprintf("%s: %s", payload.Status, activities[0].Name)
+}
+
+// GetShutdownPayload builds bot presence shown while monitoring is stopped
+func GetShutdownPayload(text string) *disgord.UpdateStatusPayload {
+	return &disgord.UpdateStatusPayload{
+		AFK:    true,
+		Game:   [1]disgord.Activity{{Name: text, Type: 3}},
+		Status: disgord.StatusDnd,
+	}
+}
+
+// GetServerStatusPayload builds bot presence of server from presence templates at rotation step,
+// offline server is shown in dnd status
+func GetServerStatusPayload(presence *core.Presence, data core.PresenceData, step int) (*disgord.UpdateStatusPayload, error) {
+	activityType, text, err := presence.Render(data, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return statusPayload(activityType, text, data), nil
+}
+
+// GetGroupStatusPayload builds presence of shared bot at rotation step, it is in dnd status when
+// shown server is offline or all servers are offline in aggregate mode
+func GetGroupStatusPayload(presence *core.GroupPresence, servers []core.PresenceData, step int) (*disgord.UpdateStatusPayload, error) {
+	activityType, text, data, err := presence.Render(servers, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return statusPayload(activityType, text, data), nil
+}
+
+func statusPayload(activityType int, text string, data core.PresenceData) *disgord.UpdateStatusPayload {
+	activity := disgord.Activity{
+		Name: text,
+		Type: disgord.ActivityType(activityType),
+	}
+
+	// custom status text is shown from activity state
+	if activityType == core.ActivityCustom {
+		activity.Name, activity.State = "Custom Status", text
+	}
+
+	payload := &disgord.UpdateStatusPayload{
+		Game: [1]disgord.Activity{activity},
+	}
+
+	switch {
+	case !data.Online:
+		payload.AFK, payload.Status = true, disgord.StatusDnd
+	case data.Players == 0:
+		payload.AFK, payload.Status = true, disgord.StatusIdle
+	default:
+		payload.Status = disgord.StatusOnline
 	}
 
-	return &payload
+	return payload
 }
@@ -0,0 +1,310 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/andersfylling/disgord"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDescriptionLength is a discord limit of embed description
+	maxDescriptionLength = 4096
+	// replyTimeout is a time discord waits for interaction response
+	replyTimeout = 3 * time.Second
+)
+
+var serverOption = &disgord.ApplicationCommandOption{
+	Type:        disgord.OptionTypeString,
+	Name:        "server",
+	Description: "Server name or config key, server of this bot by default",
+}
+
+var periodOption = &disgord.ApplicationCommandOption{
+	Type:        disgord.OptionTypeString,
+	Name:        "period",
+	Description: "Chart period, 24h by default",
+	Choices: []*disgord.ApplicationCommandOptionChoice{
+		{Name: "24h", Value: "24h"},
+		{Name: "7d", Value: "7d"},
+		{Name: "30d", Value: "30d"},
+	},
+}
+
+// commands are slash commands registered by bots with commands option, answers are built from cached poll results
+var commands = []*disgord.CreateApplicationCommand{
+	{
+		Name:        "status",
+		Description: "Show server status",
+		Options:     []*disgord.ApplicationCommandOption{serverOption},
+	},
+	{
+		Name:        "players",
+		Description: "List players online on the server",
+		Options:     []*disgord.ApplicationCommandOption{serverOption},
+	},
+	{
+		Name:        "servers",
+		Description: "Show status of all servers",
+	},
+	{
+		Name:        "chart",
+		Description: "Show players chart of the server",
+		Options:     []*disgord.ApplicationCommandOption{serverOption, periodOption},
+	},
+}
+
+// createCommands creates global slash commands of the bot application, commands with the same names are replaced
+func (b *Bot) createCommands(applicationID disgord.Snowflake) {
+	for _, command := range commands {
+		err := b.Client.ApplicationCommand(applicationID).Global().Create(command)
+		if err != nil {
+			b.logger.Warn("Failed to register slash command", "command", command.Name, "error", err)
+			return
+		}
+	}
+
+	b.logger.Debug("Slash commands registered")
+}
+
+func (b *Bot) onInteraction(s disgord.Session, h *disgord.InteractionCreate) {
+	if h.Type != disgord.InteractionApplicationCommand || h.Data == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+	defer cancel()
+
+	err := h.Reply(ctx, s, &disgord.CreateInteractionResponse{
+		Type: disgord.InteractionCallbackChannelMessageWithSource,
+		Data: b.commandResponse(ctx, h.Data),
+	})
+	if err != nil {
+		b.logger.Warn("Failed to answer slash command", "command", h.Data.Name, "error", err)
+	}
+}
+
+func (b *Bot) commandResponse(ctx context.Context, data *disgord.ApplicationCommandInteractionData) *disgord.CreateInteractionResponseData {
+	directory := b.directory()
+	if directory == nil {
+		return errorResponse("Server statuses are not available")
+	}
+
+	name := optionValue(data.Options, serverOption.Name)
+	keys := b.serverKeys()
+
+	switch {
+	case b.members != nil && (data.Name == "servers" || data.Name == "status" && name == "" && len(keys) != 1):
+		// shared bot summarizes its own servers
+		return &disgord.CreateInteractionResponseData{Embeds: []*disgord.Embed{GetGroupEmbed(b.members.name, b.members.reports())}}
+	case data.Name == "servers":
+		return &disgord.CreateInteractionResponseData{Embeds: []*disgord.Embed{GetServersEmbed(directory.Reports())}}
+	case name == "" && len(keys) != 1:
+		return errorResponse("Choose a server with the server option")
+	case name == "":
+		name = keys[0]
+	}
+
+	report, ok := findServer(directory, name)
+	if !ok {
+		return errorResponse(fmt.Sprintf("Server %q is not found", name))
+	}
+
+	switch data.Name {
+	case "status":
+		return &disgord.CreateInteractionResponseData{Embeds: []*disgord.Embed{GetStatusEmbed(reportEmbedData(report))}}
+	case "players":
+		return &disgord.CreateInteractionResponseData{Embeds: []*disgord.Embed{GetPlayersEmbed(report)}}
+	case "chart":
+		return b.chartResponse(ctx, report, optionValue(data.Options, periodOption.Name))
+	}
+
+	return errorResponse(fmt.Sprintf("Unknown command %q", data.Name))
+}
+
+// directory returns reports of all servers, shared bot takes it from any of its servers
+func (b *Bot) directory() core.Directory {
+	if b.members == nil {
+		return b.poller.Directory()
+	}
+
+	if pollers := b.members.pollers(); len(pollers) > 0 {
+		return pollers[0].Directory()
+	}
+
+	return nil
+}
+
+// chart returns players chart renderer, shared bot takes it from any of its servers
+func (b *Bot) chart() core.ChartFunc {
+	if b.members == nil {
+		return b.poller.Chart()
+	}
+
+	if pollers := b.members.pollers(); len(pollers) > 0 {
+		return pollers[0].Chart()
+	}
+
+	return nil
+}
+
+// chartResponse renders players chart of the server for period, 24h by default
+func (b *Bot) chartResponse(ctx context.Context, report core.ServerReport, period string) *disgord.CreateInteractionResponseData {
+	render := b.chart()
+	if render == nil {
+		return errorResponse("Players charts are not available")
+	}
+
+	if period == "" {
+		period = "24h"
+	}
+
+	var png bytes.Buffer
+
+	err := render(ctx, &png, report.Key, report.Name, period)
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to draw players chart: %s", err.Error()))
+	}
+
+	return GetChartResponse(report.Name, period, png.Bytes())
+}
+
+// serverKeys returns keys of servers shown by the bot, servers of shared bot are sorted
+func (b *Bot) serverKeys() []string {
+	if b.members == nil {
+		return []string{b.poller.Key}
+	}
+
+	var keys []string
+	for _, poller := range b.members.pollers() {
+		keys = append(keys, poller.Key)
+	}
+
+	return keys
+}
+
+// findServer returns report of server with config key or name
+func findServer(directory core.Directory, name string) (core.ServerReport, bool) {
+	if report, ok := directory.Report(name); ok {
+		return report, true
+	}
+
+	for _, report := range directory.Reports() {
+		if strings.EqualFold(report.Name, name) {
+			return report, true
+		}
+	}
+
+	return core.ServerReport{}, false
+}
+
+func optionValue(options []*disgord.ApplicationCommandDataOption, name string) string {
+	for _, option := range options {
+		if value, ok := option.Value.(string); ok && option.Name == name {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return ""
+}
+
+// errorResponse is shown only to the member who used the command
+func errorResponse(text string) *disgord.CreateInteractionResponseData {
+	return &disgord.CreateInteractionResponseData{Content: text, Flags: disgord.MessageFlagEphemeral}
+}
+
+func reportEmbedData(report core.ServerReport) EmbedData {
+	data := EmbedData{Name: report.Name, Address: report.Address, Status: report.Status}
+	if report.OnlineSince != nil {
+		data.OnlineSince = *report.OnlineSince
+	}
+
+	return data
+}
+
+// GetPlayersEmbed builds list of players online on server, names are shown if game reports them
+func GetPlayersEmbed(report core.ServerReport) *disgord.Embed {
+	embed := &disgord.Embed{
+		Title: fmt.Sprintf("%s players", report.Name),
+		Color: colorOffline,
+	}
+
+	status := report.Status
+	switch {
+	case status == nil || !status.Online:
+		embed.Description = "Server is offline"
+	case status.Players == 0:
+		embed.Description, embed.Color = "No players online", colorOnline
+	case len(status.PlayerList) == 0:
+		embed.Description, embed.Color = fmt.Sprintf("%d players online, server doesn't report their names", status.Players), colorOnline
+	default:
+		embed.Description, embed.Color = playerList(status.PlayerList, maxDescriptionLength), colorOnline
+		embed.Footer = &disgord.EmbedFooter{Text: fmt.Sprintf("%d/%d", status.Players, status.MaxPlayers)}
+	}
+
+	return embed
+}
+
+// GetGroupEmbed builds status message of shared bot, it lists servers of the bot
+func GetGroupEmbed(name string, reports []core.ServerReport) *disgord.Embed {
+	embed := GetServersEmbed(reports)
+	embed.Title = name
+	embed.Footer = &disgord.EmbedFooter{Text: "Last updated"}
+
+	return embed
+}
+
+// GetServersEmbed builds summary of enabled servers, one line per server
+func GetServersEmbed(reports []core.ServerReport) *disgord.Embed {
+	var description strings.Builder
+	for _, report := range reports {
+		if !report.Enabled {
+			continue
+		}
+
+		var line string
+
+		status := report.Status
+		switch {
+		case status == nil:
+			line = fmt.Sprintf(":white_circle: **%s** unknown", report.Name)
+		case !status.Online:
+			line = fmt.Sprintf(":red_circle: **%s** offline", report.Name)
+		case status.Map != "":
+			line = fmt.Sprintf(":green_circle: **%s** %d/%d on %s", report.Name, status.Players, status.MaxPlayers, status.Map)
+		default:
+			line = fmt.Sprintf(":green_circle: **%s** %d/%d", report.Name, status.Players, status.MaxPlayers)
+		}
+
+		if description.Len()+len(line)+1 > maxDescriptionLength {
+			break
+		}
+
+		description.WriteString(line)
+		description.WriteString("\n")
+	}
+
+	if description.Len() == 0 {
+		description.WriteString("No servers are enabled")
+	}
+
+	return &disgord.Embed{
+		Title:       "Servers",
+		Description: strings.TrimSuffix(description.String(), "\n"),
+		Timestamp:   disgord.Time{Time: time.Now()},
+	}
+}
+
+// GetChartResponse builds command answer with players chart attached, png is rendered by chart package
+func GetChartResponse(serverName string, period string, png []byte) *disgord.CreateInteractionResponseData {
+	return &disgord.CreateInteractionResponseData{
+		Content: fmt.Sprintf("%s players, last %s", serverName, period),
+		Files: []disgord.CreateMessageFile{{
+			Reader:   bytes.NewReader(png),
+			FileName: fmt.Sprintf("players-%s.png", period),
+		}},
+	}
+}
@@ -0,0 +1,145 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"github.com/andersfylling/disgord"
+	"sync"
+	"time"
+)
+
+// renameRetryDelay is a time after which failed rename of counter channel is tried again
+const renameRetryDelay = time.Minute
+
+// channelRenames are rename limiters of counter channels by channel id. They outlive runs of servers,
+// so restarted and reloaded servers stay within discord rename limit of the channel.
+var channelRenames = struct {
+	sync.Mutex
+	m map[string]*rateLimiter
+}{m: make(map[string]*rateLimiter)}
+
+// renameWait returns time left until the next rename of channel is allowed
+func renameWait(channelID string) time.Duration {
+	channelRenames.Lock()
+	defer channelRenames.Unlock()
+
+	if limiter, ok := channelRenames.m[channelID]; ok {
+		return limiter.wait()
+	}
+
+	return 0
+}
+
+// recordRename counts rename of channel done now
+func recordRename(channelID string) {
+	channelRenames.Lock()
+	defer channelRenames.Unlock()
+
+	limiter, ok := channelRenames.m[channelID]
+	if !ok {
+		limiter = &rateLimiter{limit: core.CounterRenames, window: core.CounterRenameWindow}
+		channelRenames.m[channelID] = limiter
+	}
+
+	limiter.record()
+}
+
+// counterChannel tracks id and current name of counter channel
+type counterChannel struct {
+	id   string
+	name string
+}
+
+// runCounter renames counter channel on status changes until ctx is done.
+// Renames are limited by discord, status changes until the next allowed rename are merged into one.
+func (b *Bot) runCounter(ctx context.Context) {
+	listener, status := b.poller.Subscribe()
+	defer listener.Close()
+
+	var channel counterChannel
+	var throttle <-chan time.Time
+
+	pending := status != nil
+
+	for {
+		if pending && throttle == nil {
+			serverConfig := b.poller.Config()
+
+			if channel.id != serverConfig.Counter.ChannelID {
+				channel = counterChannel{id: serverConfig.Counter.ChannelID, name: b.channelName(serverConfig.Counter.ChannelID)}
+			}
+
+			name := b.counterName(serverConfig, status)
+
+			// rename limit is checked only when there is a channel to rename
+			if channel.id == "" || name == "" || name == channel.name {
+				pending = false
+			} else if wait := renameWait(channel.id); wait > 0 {
+				b.logger.Debug("Counter channel rename is delayed by rate limit", "channel", channel.id, "wait", wait)
+				throttle = time.After(wait)
+			} else if b.renameChannel(channel.id, name) {
+				channel.name = name
+				recordRename(channel.id)
+				pending = false
+			} else {
+				// failed rename is retried even if status doesn't change
+				throttle = time.After(renameRetryDelay)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case status = <-listener.Ch():
+			pending = true
+		case <-throttle:
+			throttle = nil
+		}
+	}
+}
+
+// counterName renders channel name of status, empty name is returned if counter is disabled or template fails
+func (b *Bot) counterName(serverConfig core.ServerConfig, status *core.ServerStatus) string {
+	if serverConfig.CompiledCounter == nil {
+		return ""
+	}
+
+	name, err := serverConfig.CompiledCounter.Render(b.presenceData(status))
+	if err != nil {
+		b.logger.Warn("Failed to render counter channel name", "error", err)
+	}
+
+	return name
+}
+
+// channelName returns current name of channel, so restarted bot doesn't spend a rename on the same name
+func (b *Bot) channelName(channelID string) string {
+	if channelID == "" || b.dryRun {
+		return ""
+	}
+
+	channel, err := b.Client.Channel(disgord.ParseSnowflakeString(channelID)).Get()
+	if err != nil {
+		b.logger.Warn("Failed to get counter channel", "channel", channelID, "error", err)
+		return ""
+	}
+
+	return channel.Name
+}
+
+func (b *Bot) renameChannel(channelID string, name string) bool {
+	if b.dryRun {
+		b.logger.Info("Dry run: discord channel is not renamed", "channel", channelID, "name", name)
+		return true
+	}
+
+	_, err := b.Client.Channel(disgord.ParseSnowflakeString(channelID)).Update(&disgord.UpdateChannel{Name: &name})
+	if err != nil {
+		b.logger.Warn("Failed to rename counter channel", "channel", channelID, "error", err)
+		return false
+	}
+
+	b.logger.Debug("Counter channel renamed", "channel", channelID, "name", name)
+
+	return true
+}
@@ -0,0 +1,300 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andersfylling/disgord"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// minEmbedGap is a minimal time between edits of status message, edits share rate limit of the channel
+	minEmbedGap = 5 * time.Second
+	// maxFieldLength is a discord limit of embed field value
+	maxFieldLength = 1024
+
+	colorOnline  = 0x43b581
+	colorOffline = 0xf04747
+)
+
+// embedMessage is a status message stored in state file, it is edited until its channel or webhook changes
+// or message is deleted
+type embedMessage struct {
+	ChannelID string `json:"channelID,omitempty"`
+	WebhookID string `json:"webhookID,omitempty"`
+	MessageID string `json:"messageID"`
+}
+
+// EmbedData is a server info shown in status message
+type EmbedData struct {
+	Name    string
+	Address string
+	Status  *core.ServerStatus
+	// OnlineSince is zero while server is offline
+	OnlineSince time.Time
+}
+
+// runEmbed keeps status message of the server in sync with poller statuses until ctx is done.
+// Message is created on the first status and edited afterwards, its id is kept in state file.
+func (b *Bot) runEmbed(ctx context.Context) {
+	listener, status := b.poller.Subscribe()
+	defer listener.Close()
+
+	b.runStatusMessage(ctx, listener.Ch(), status != nil, "embed."+b.poller.Key, b.poller.StateFile(), b.serverEmbed)
+}
+
+// serverEmbed returns status message config and embed of the latest server status
+func (b *Bot) serverEmbed() (core.EmbedConfig, *disgord.Embed) {
+	serverConfig := b.poller.Config()
+	status, _ := b.poller.Last()
+
+	return serverConfig.Embed, GetStatusEmbed(EmbedData{
+		Name:        serverConfig.Name,
+		Address:     serverConfig.Address(),
+		Status:      status,
+		OnlineSince: b.poller.OnlineSince(),
+	})
+}
+
+// runStatusMessage updates status message rendered by render on updates until ctx is done, nil embed is not sent.
+// Message id is kept in state file under stateKey.
+func (b *Bot) runStatusMessage(ctx context.Context, updates <-chan *core.ServerStatus, pending bool, stateKey string,
+	stateFile *core.StateFile, render func() (core.EmbedConfig, *disgord.Embed)) {
+	if stateFile != nil {
+		stateFile.Get(stateKey, &b.embed)
+	}
+
+	var lastSent time.Time
+	var throttle <-chan time.Time
+
+	for {
+		if pending && throttle == nil {
+			if wait := minEmbedGap - time.Since(lastSent); wait > 0 {
+				throttle = time.After(wait)
+			} else {
+				config, embed := render()
+				if embed != nil {
+					b.updateEmbed(ctx, stateKey, stateFile, config, embed)
+					lastSent = time.Now()
+				}
+				pending = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-updates:
+			pending = true
+		case <-throttle:
+			throttle = nil
+		}
+	}
+}
+
+// updateEmbed edits status message or creates it if there is none in configured channel or webhook
+func (b *Bot) updateEmbed(ctx context.Context, stateKey string, stateFile *core.StateFile, config core.EmbedConfig,
+	embed *disgord.Embed) {
+	target := embedMessage{ChannelID: config.ChannelID}
+	if config.Webhook != "" {
+		webhookID, _ := core.ParseWebhookURL(config.Webhook)
+		target = embedMessage{WebhookID: webhookID}
+	}
+
+	if target == (embedMessage{}) {
+		return
+	}
+
+	if b.dryRun {
+		b.logger.Info("Dry run: discord status message is not sent",
+			"channel", target.ChannelID, "webhook", target.WebhookID, "status", embed.Description)
+		return
+	}
+
+	created, err := b.sendEmbed(ctx, config, target, embed)
+	if err != nil {
+		b.logger.Warn("Failed to update discord status message", "error", err,
+			"channel", target.ChannelID, "webhook", target.WebhookID)
+		return
+	}
+
+	if !created {
+		return
+	}
+
+	b.logger.Info("Discord status message created",
+		"channel", b.embed.ChannelID, "webhook", b.embed.WebhookID, "message", b.embed.MessageID)
+
+	if stateFile != nil {
+		err = stateFile.Set(stateKey, b.embed)
+		if err != nil {
+			b.logger.Warn("Failed to save discord status message id", "error", err)
+		}
+	}
+}
+
+// sendEmbed edits the known status message, new message is created if target changed or message was deleted
+func (b *Bot) sendEmbed(ctx context.Context, config core.EmbedConfig, target embedMessage,
+	embed *disgord.Embed) (created bool, err error) {
+	if b.embed.ChannelID == target.ChannelID && b.embed.WebhookID == target.WebhookID && b.embed.MessageID != "" {
+		err = b.editMessage(ctx, config, b.embed.MessageID, embed)
+		if !errors.Is(err, errMessageNotFound) {
+			return false, err
+		}
+
+		b.logger.Info("Discord status message was deleted, creating a new one", "message", b.embed.MessageID)
+	}
+
+	target.MessageID, err = b.createMessage(ctx, config, embed)
+	if err != nil {
+		return false, err
+	}
+
+	b.embed = target
+
+	return true, nil
+}
+
+// createMessage posts message through webhook if it is set, otherwise bot posts it to the channel
+func (b *Bot) createMessage(ctx context.Context, config core.EmbedConfig, embed *disgord.Embed) (string, error) {
+	if config.Webhook != "" {
+		webhook, err := NewWebhook(config.Webhook)
+		if err != nil {
+			return "", err
+		}
+
+		return webhook.Create(ctx, embed)
+	}
+
+	message, err := b.Client.Channel(disgord.ParseSnowflakeString(config.ChannelID)).CreateMessage(&disgord.CreateMessage{
+		Embeds: []*disgord.Embed{embed},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return message.ID.String(), nil
+}
+
+// editMessage replaces embed of message, errMessageNotFound is returned if message was deleted
+func (b *Bot) editMessage(ctx context.Context, config core.EmbedConfig, messageID string, embed *disgord.Embed) error {
+	if config.Webhook != "" {
+		webhook, err := NewWebhook(config.Webhook)
+		if err != nil {
+			return err
+		}
+
+		return webhook.Edit(ctx, messageID, embed)
+	}
+
+	channel := b.Client.Channel(disgord.ParseSnowflakeString(config.ChannelID))
+
+	_, err := channel.Message(disgord.ParseSnowflakeString(messageID)).Update(&disgord.UpdateMessage{
+		Embeds: &[]*disgord.Embed{embed},
+	})
+
+	var restErr *disgord.ErrRest
+	if errors.As(err, &restErr) && restErr.HTTPCode == http.StatusNotFound {
+		return errMessageNotFound
+	}
+
+	return err
+}
+
+// GetStatusEmbed builds status message of server, offline server has only status and address fields
+func GetStatusEmbed(data EmbedData) *disgord.Embed {
+	embed := &disgord.Embed{
+		Title:     data.Name,
+		Timestamp: disgord.Time{Time: time.Now()},
+		Footer:    &disgord.EmbedFooter{Text: "Last updated"},
+	}
+
+	status := data.Status
+	if status == nil || !status.Online {
+		embed.Description, embed.Color = "Offline", colorOffline
+	} else if status.Stale {
+		embed.Description, embed.Color = "Online, not responding to the latest queries", colorOnline
+	} else {
+		embed.Description, embed.Color = "Online", colorOnline
+	}
+
+	if data.Address != "" {
+		embed.Fields = append(embed.Fields, &disgord.EmbedField{Name: "Address", Value: data.Address, Inline: true})
+	}
+
+	if status == nil || !status.Online {
+		return embed
+	}
+
+	if status.Map != "" {
+		embed.Fields = append(embed.Fields, &disgord.EmbedField{Name: "Map", Value: status.Map, Inline: true})
+	}
+
+	embed.Fields = append(embed.Fields, &disgord.EmbedField{
+		Name:   "Players",
+		Value:  fmt.Sprintf("%d/%d", status.Players, status.MaxPlayers),
+		Inline: true,
+	})
+
+	if !data.OnlineSince.IsZero() {
+		embed.Fields = append(embed.Fields, &disgord.EmbedField{
+			Name:   "Uptime",
+			Value:  formatDuration(time.Since(data.OnlineSince)),
+			Inline: true,
+		})
+	}
+
+	if len(status.PlayerList) > 0 {
+		embed.Fields = append(embed.Fields, &disgord.EmbedField{
+			Name:  "Player list",
+			Value: playerList(status.PlayerList, maxFieldLength),
+		})
+	}
+
+	return embed
+}
+
+// playerList joins player names by lines, names which don't fit into limit are counted in the last line
+func playerList(players []string, limit int) string {
+	var list strings.Builder
+
+	for i, player := range players {
+		more := fmt.Sprintf("and %d more", len(players)-i)
+
+		// the last name doesn't need room for the count
+		reserved := len(more)
+		if i == len(players)-1 {
+			reserved = 0
+		}
+
+		if list.Len()+len(player)+1+reserved > limit {
+			list.WriteString(more)
+			break
+		}
+
+		list.WriteString(player)
+		list.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(list.String(), "\n")
+}
+
+// formatDuration formats duration in days, hours and minutes, like 2d 3h 15m
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Minutes())
+	days, hours := minutes/(24*60), minutes/60%24
+	minutes %= 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
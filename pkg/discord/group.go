@@ -0,0 +1,399 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"fmt"
+	"github.com/andersfylling/disgord"
+	"github.com/teivah/broadcast"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// groups are connected shared bots by groupKey
+var groups = struct {
+	sync.Mutex
+	m map[string]*group
+}{m: make(map[string]*group)}
+
+// group is a discord bot shared by several servers. It is connected by the first server which joins it
+// and disconnected when the last one leaves, so restart of a single server keeps it connected.
+type group struct {
+	name string
+	key  string
+	bot  *Bot
+	// initial is a shared bot config of the server which connected the group
+	initial   core.BotConfig
+	stateFile *core.StateFile
+	// relay notifies presence and status message loops about statuses of servers of the group
+	relay *broadcast.Relay[*core.ServerStatus]
+	// ready is closed when connection attempt is finished, err is set if it failed
+	ready  chan struct{}
+	err    error
+	cancel context.CancelFunc
+	// done is closed when shared bot is disconnected, failure is set before it if the group panicked
+	done    chan struct{}
+	failure error
+	// refs counts servers which joined the group or wait for it to connect, it is guarded by groups lock
+	refs int
+
+	mu      sync.Mutex
+	members map[string]*core.Poller
+	state   string
+}
+
+// groupKey identifies connection of shared bot, servers with changed token or commands option need a new one
+func groupKey(serverConfig core.ServerConfig) string {
+	return fmt.Sprintf("%s/%s/%t", serverConfig.Bot, serverConfig.BotToken, serverConfig.CommandsEnabled())
+}
+
+// serveShared runs status message, counter channel and alert loops of the server with client of its shared bot
+// until ctx is done, presence of the server is shown by the shared bot
+func (b *Bot) serveShared(ctx context.Context) error {
+	g, err := joinGroup(ctx, b)
+	if err != nil {
+		return err
+	}
+
+	// server outputs are sent by client of the shared bot
+	b.Client = g.bot.Client
+
+	listener, _ := b.poller.Subscribe()
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err = b.runOutputs(ctx, func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-g.done:
+				// shared bot failed, the server is restarted and connects a new one
+				cancel()
+				return
+			case status := <-listener.Ch():
+				g.relay.Broadcast(status)
+			}
+		}
+	})
+	g.leave(b.poller)
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-g.done:
+		return g.failure
+	default:
+		return nil
+	}
+}
+
+// joinGroup adds server of the bot to its shared bot, shared bot is connected by the first server
+func joinGroup(ctx context.Context, b *Bot) (*group, error) {
+	serverConfig := b.poller.Config()
+	key := groupKey(serverConfig)
+
+	groups.Lock()
+	g, ok := groups.m[key]
+	if !ok {
+		g = newGroup(key, serverConfig, b)
+		groups.m[key] = g
+	}
+	g.refs++
+	groups.Unlock()
+
+	if !ok {
+		g.connect(ctx, serverConfig)
+	}
+
+	select {
+	case <-g.ready:
+	case <-ctx.Done():
+		g.leave(nil)
+		return nil, ctx.Err()
+	}
+
+	if g.err != nil {
+		g.leave(nil)
+		return nil, fmt.Errorf("shared bot %s failed to connect: %w", g.name, g.err)
+	}
+
+	g.add(b.poller)
+
+	return g, nil
+}
+
+func newGroup(key string, serverConfig core.ServerConfig, b *Bot) *group {
+	g := &group{
+		name:      serverConfig.Bot,
+		key:       key,
+		initial:   *serverConfig.SharedBot,
+		stateFile: b.poller.StateFile(),
+		relay:     broadcast.NewRelay[*core.ServerStatus](),
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+		members:   make(map[string]*core.Poller),
+	}
+
+	g.bot = &Bot{
+		logger:           b.poller.BaseLogger().With("bot", g.name),
+		shutdownPresence: b.shutdownPresence,
+		dryRun:           b.dryRun,
+		resend:           make(chan struct{}, 1),
+		members:          g,
+	}
+
+	return g
+}
+
+// connect creates client of shared bot and connects it to discord, the group runs until the last server leaves it.
+// Connection is interrupted when ctx of the joining server is done, connected group doesn't depend on it.
+func (g *group) connect(joinCtx context.Context, serverConfig core.ServerConfig) {
+	defer close(g.ready)
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(joinCtx))
+	g.cancel = cancel
+
+	if g.bot.dryRun {
+		g.setBotState(core.BotDryRun)
+		go g.run(ctx)
+
+		return
+	}
+
+	interrupt := context.AfterFunc(joinCtx, cancel)
+
+	client, err := disgord.NewClient(ctx, disgord.Config{
+		BotToken:     serverConfig.BotToken,
+		ProjectName:  g.name,
+		DisableCache: true,
+	})
+	if err == nil {
+		g.bot.Client = client
+		err = g.bot.connect(ctx, g.initial.Commands)
+	}
+
+	// joining server stopped while bot was connecting
+	if !interrupt() && err == nil {
+		_ = client.Gateway().Disconnect()
+		err = joinCtx.Err()
+	}
+
+	if err != nil {
+		cancel()
+		g.err = err
+
+		// servers restarted after failure connect a new group
+		groups.Lock()
+		if groups.m[g.key] == g {
+			delete(groups.m, g.key)
+		}
+		groups.Unlock()
+
+		return
+	}
+
+	go g.run(ctx)
+}
+
+// run sends presence and status message of shared bot until ctx is canceled by the last server leaving.
+// Panic stops the group, so its servers fail and connect a new one.
+func (g *group) run(ctx context.Context) {
+	defer close(g.done)
+
+	listener := g.relay.Listener(1)
+	defer listener.Close()
+
+	send := g.bot.updatePresence
+	if g.bot.dryRun {
+		send = g.bot.logDryRun
+	}
+
+	tasks, ctx := core.NewTasks(ctx)
+	tasks.Go(func() { g.runEmbed(ctx) })
+	tasks.Go(func() { g.bot.runPresence(ctx, listener.Ch(), groupPresence{g}, send) })
+
+	err := tasks.Wait()
+	if err != nil {
+		g.bot.logger.Error("Shared discord bot failed", "error", err)
+		g.failure = err
+
+		groups.Lock()
+		if groups.m[g.key] == g {
+			delete(groups.m, g.key)
+		}
+		groups.Unlock()
+	}
+
+	if g.bot.dryRun {
+		return
+	}
+
+	err = g.bot.disconnect()
+	if err != nil {
+		g.bot.logger.Warn("Failed to disconnect shared discord bot", "error", err)
+	}
+}
+
+// runEmbed keeps status message listing servers of the group in sync until ctx is done
+func (g *group) runEmbed(ctx context.Context) {
+	listener := g.relay.Listener(1)
+	defer listener.Close()
+
+	g.bot.runStatusMessage(ctx, listener.Ch(), true, "embed.bot."+g.name, g.stateFile, g.embed)
+}
+
+// embed returns status message config and embed of the group, embed is nil until a server status is known
+func (g *group) embed() (core.EmbedConfig, *disgord.Embed) {
+	config, reports := g.config(), g.reports()
+
+	known := slices.ContainsFunc(reports, func(report core.ServerReport) bool {
+		return report.Status != nil
+	})
+	if !known {
+		return config.Embed, nil
+	}
+
+	return config.Embed, GetGroupEmbed(g.name, reports)
+}
+
+func (g *group) add(poller *core.Poller) {
+	g.mu.Lock()
+	g.members[poller.Key] = poller
+	poller.SetBotState(g.state)
+	g.mu.Unlock()
+
+	g.relay.Broadcast(nil)
+}
+
+// leave removes server from the group, the last server disconnects shared bot and waits for it.
+// Nil poller leaves the group before it is joined.
+func (g *group) leave(poller *core.Poller) {
+	if poller != nil {
+		g.mu.Lock()
+		if g.members[poller.Key] == poller {
+			delete(g.members, poller.Key)
+		}
+		g.mu.Unlock()
+
+		g.relay.Broadcast(nil)
+	}
+
+	groups.Lock()
+	g.refs--
+	last := g.refs == 0
+	if last && groups.m[g.key] == g {
+		delete(groups.m, g.key)
+	}
+	groups.Unlock()
+
+	if last && g.err == nil {
+		g.cancel()
+		<-g.done
+	}
+}
+
+func (g *group) setBotState(state string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.state = state
+	for _, poller := range g.members {
+		poller.SetBotState(state)
+	}
+}
+
+// pollers returns pollers of servers in the group sorted by key
+func (g *group) pollers() []*core.Poller {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pollers := make([]*core.Poller, 0, len(g.members))
+	for _, poller := range g.members {
+		pollers = append(pollers, poller)
+	}
+
+	sort.Slice(pollers, func(i, j int) bool {
+		return pollers[i].Key < pollers[j].Key
+	})
+
+	return pollers
+}
+
+// config returns shared bot config of the first server, reloaded config is applied to all servers of the group
+func (g *group) config() core.BotConfig {
+	for _, poller := range g.pollers() {
+		if sharedBot := poller.Config().SharedBot; sharedBot != nil {
+			return *sharedBot
+		}
+	}
+
+	return g.initial
+}
+
+// reports returns reports of servers in the group sorted by key
+func (g *group) reports() []core.ServerReport {
+	pollers := g.pollers()
+
+	reports := make([]core.ServerReport, 0, len(pollers))
+	for _, poller := range pollers {
+		status, _ := poller.Last()
+		serverConfig := poller.Config()
+		reports = append(reports, core.ServerReport{
+			Key:     poller.Key,
+			Name:    serverConfig.Name,
+			Game:    serverConfig.Game,
+			Enabled: true,
+			Address: serverConfig.Address(),
+			Bot:     poller.BotState(),
+			Status:  status,
+		})
+	}
+
+	return reports
+}
+
+// groupPresence is a presence of shared bot, it rotates through servers of the group or aggregates them
+type groupPresence struct {
+	group *group
+}
+
+// servers returns presence data of servers with known status
+func (p groupPresence) servers() []core.PresenceData {
+	var servers []core.PresenceData
+
+	for _, poller := range p.group.pollers() {
+		if status, _ := poller.Last(); status != nil {
+			servers = append(servers, presenceData(poller, status))
+		}
+	}
+
+	return servers
+}
+
+func (p groupPresence) steps() (int, time.Duration) {
+	presence := p.group.config().CompiledPresence
+
+	return presence.Steps(p.servers()), presence.RotationInterval
+}
+
+// payload renders presence of the latest statuses, nil is returned if no status is known or template fails
+func (p groupPresence) payload(step int) *disgord.UpdateStatusPayload {
+	servers := p.servers()
+	if len(servers) == 0 {
+		return nil
+	}
+
+	payload, err := GetGroupStatusPayload(p.group.config().CompiledPresence, servers, step)
+	if err != nil {
+		p.group.bot.logger.Warn("Failed to render bot presence", "error", err)
+	}
+
+	return payload
+}
@@ -0,0 +1,46 @@
+package discord
+
+import (
+	"time"
+)
+
+// rateLimiter allows limit events per sliding window, gap is a minimal time between events
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	gap    time.Duration
+	// sent are times of recent events, the oldest first
+	sent []time.Time
+}
+
+// wait returns time left until the next event is allowed
+func (l *rateLimiter) wait() time.Duration {
+	var wait time.Duration
+
+	if len(l.sent) > 0 {
+		wait = l.gap - time.Since(l.sent[len(l.sent)-1])
+	}
+
+	if len(l.sent) > 0 && len(l.sent) >= l.limit {
+		wait = max(wait, l.window-time.Since(l.sent[0]))
+	}
+
+	return max(wait, 0)
+}
+
+// record counts event sent now, the latest event is kept even without limit, gap is counted from it
+func (l *rateLimiter) record() {
+	l.sent = append(l.sent, time.Now())
+	if len(l.sent) > max(l.limit, 1) {
+		l.sent = l.sent[1:]
+	}
+}
+
+// last returns time of the latest event, zero if there were none
+func (l *rateLimiter) last() time.Time {
+	if len(l.sent) == 0 {
+		return time.Time{}
+	}
+
+	return l.sent[len(l.sent)-1]
+}
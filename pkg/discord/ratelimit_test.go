@@ -0,0 +1,90 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter rateLimiter
+		records int
+		// wait is expected within a second below it, zero exactly
+		wait time.Duration
+	}{
+		{name: "zero value", limiter: rateLimiter{}, wait: 0},
+		{name: "zero value after event", limiter: rateLimiter{}, records: 3, wait: 0},
+		{name: "gap before event", limiter: rateLimiter{gap: 5 * time.Second}, wait: 0},
+		{name: "gap only", limiter: rateLimiter{gap: 5 * time.Second}, records: 3, wait: 5 * time.Second},
+		{name: "window not full", limiter: rateLimiter{limit: 2, window: time.Minute}, records: 1, wait: 0},
+		{name: "window full", limiter: rateLimiter{limit: 2, window: time.Minute}, records: 2, wait: time.Minute},
+		{
+			name:    "window full with gap",
+			limiter: rateLimiter{limit: 5, window: time.Minute, gap: 5 * time.Second},
+			records: 5,
+			wait:    time.Minute,
+		},
+		{
+			name:    "gap in window",
+			limiter: rateLimiter{limit: 5, window: time.Minute, gap: 5 * time.Second},
+			records: 1,
+			wait:    5 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := test.limiter
+			for i := 0; i < test.records; i++ {
+				limiter.record()
+			}
+
+			wait := limiter.wait()
+
+			if test.wait == 0 && wait != 0 || wait > test.wait || wait < test.wait-time.Second {
+				t.Errorf("wait() = %v, want %v", wait, test.wait)
+			}
+
+			if limit := max(limiter.limit, 1); len(limiter.sent) > limit {
+				t.Errorf("record() kept %d events, want at most %d", len(limiter.sent), limit)
+			}
+		})
+	}
+}
+
+func TestRateLimiterLast(t *testing.T) {
+	var limiter rateLimiter
+	if !limiter.last().IsZero() {
+		t.Fatalf("last() = %v before events, want zero", limiter.last())
+	}
+
+	before := time.Now()
+	limiter.record()
+
+	if last := limiter.last(); last.Before(before) {
+		t.Errorf("last() = %v, want time of the recorded event", last)
+	}
+}
+
+func TestChannelRenames(t *testing.T) {
+	const channelID = "test-channel-renames"
+
+	if wait := renameWait(channelID); wait != 0 {
+		t.Fatalf("renameWait() = %v before renames, want 0", wait)
+	}
+
+	// limiter of the channel is shared by all runs
+	for i := 0; i < core.CounterRenames; i++ {
+		recordRename(channelID)
+	}
+
+	if wait := renameWait(channelID); wait < core.CounterRenameWindow-time.Second {
+		t.Errorf("renameWait() = %v after %d renames, want about %v", wait, core.CounterRenames, core.CounterRenameWindow)
+	}
+
+	if wait := renameWait("test-other-channel"); wait != 0 {
+		t.Errorf("renameWait() of other channel = %v, want 0", wait)
+	}
+}
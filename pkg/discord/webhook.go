@@ -0,0 +1,107 @@
+package discord
+
+import (
+	"DiscordMBM/pkg/core"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andersfylling/disgord"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// errMessageNotFound is returned when status message to edit was deleted
+var errMessageNotFound = errors.New("message not found")
+
+// webhookTimeout limits a single webhook request
+const webhookTimeout = 10 * time.Second
+
+// Webhook posts and edits messages through discord webhook url, it doesn't need bot token
+type Webhook struct {
+	ID  string
+	url string
+}
+
+type webhookMessage struct {
+	Embeds []*disgord.Embed `json:"embeds"`
+}
+
+// NewWebhook creates webhook client of discord webhook url
+func NewWebhook(rawURL string) (*Webhook, error) {
+	id, ok := core.ParseWebhookURL(rawURL)
+	if !ok {
+		return nil, errors.New("invalid discord webhook url")
+	}
+
+	return &Webhook{ID: id, url: rawURL}, nil
+}
+
+// Create posts message with embed and returns its id
+func (w *Webhook) Create(ctx context.Context, embed *disgord.Embed) (string, error) {
+	var message struct {
+		ID string `json:"id"`
+	}
+
+	// wait makes discord return created message, its id is needed to edit it later
+	err := w.request(ctx, http.MethodPost, w.url+"?wait=true", embed, &message)
+	if err != nil {
+		return "", err
+	}
+
+	return message.ID, nil
+}
+
+// Edit replaces embed of message posted by webhook, errMessageNotFound is returned if message was deleted
+func (w *Webhook) Edit(ctx context.Context, messageID string, embed *disgord.Embed) error {
+	return w.request(ctx, http.MethodPatch, w.url+"/messages/"+messageID, embed, nil)
+}
+
+func (w *Webhook) request(ctx context.Context, method string, endpoint string, embed *disgord.Embed, response any) error {
+	body, err := json.Marshal(webhookMessage{Embeds: []*disgord.Embed{embed}})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// url contains webhook token, so it is not included into error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodPatch:
+		return errMessageNotFound
+	case resp.StatusCode >= 300:
+		return errors.New(fmt.Sprintf("webhook request failed with status %d: %s", resp.StatusCode, data))
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, response)
+}
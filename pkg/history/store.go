@@ -0,0 +1,281 @@
+package history
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	_ "modernc.org/sqlite"
+	"time"
+)
+
+const (
+	// bufferSize is a number of samples waiting to be written, samples are dropped when buffer is full
+	bufferSize = 1024
+	// batchSize limits number of samples written in a single transaction
+	batchSize       = 100
+	compactInterval = time.Hour
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS samples (
+	server      TEXT    NOT NULL,
+	time        INTEGER NOT NULL,
+	online      INTEGER NOT NULL,
+	players     INTEGER NOT NULL,
+	max_players INTEGER NOT NULL,
+	map         TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS samples_server_time ON samples (server, time);
+CREATE TABLE IF NOT EXISTS hourly_samples (
+	server      TEXT    NOT NULL,
+	time        INTEGER NOT NULL,
+	online      INTEGER NOT NULL,
+	players     INTEGER NOT NULL,
+	avg_players REAL    NOT NULL,
+	max_players INTEGER NOT NULL,
+	PRIMARY KEY (server, time)
+);`
+
+// samplesQuery selects raw and hourly samples of a server in time range, raw samples have map
+// and their average is players
+const samplesQuery = `
+SELECT time, online, players, avg_players, max_players, '' FROM hourly_samples WHERE server = ? AND time >= ? AND time < ?
+UNION ALL
+SELECT time, online, players, players, max_players, map FROM samples WHERE server = ? AND time >= ? AND time < ?`
+
+// Sample is a player count of a server at a point of time.
+// Downsampled hourly sample has peak and average players of the hour and is online if server was online at least once.
+type Sample struct {
+	Time       time.Time `json:"time"`
+	Online     bool      `json:"online"`
+	Players    int       `json:"players"`
+	AvgPlayers float64   `json:"avgPlayers"`
+	MaxPlayers int       `json:"maxPlayers"`
+	Map        string    `json:"map,omitempty"`
+}
+
+type record struct {
+	key    string
+	sample Sample
+}
+
+// Store keeps every published server status in sqlite database, it implements core.Recorder
+type Store struct {
+	db      *sql.DB
+	config  core.HistoryConfig
+	logger  *slog.Logger
+	records chan record
+	done    chan struct{}
+}
+
+// Open opens or creates history database at config path
+func Open(config core.HistoryConfig, logger *slog.Logger) (*Store, error) {
+	db, err := sql.Open("sqlite", config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer, pool of one connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("PRAGMA journal_mode = WAL; PRAGMA busy_timeout = 5000;" + schema)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.New(fmt.Sprintf("failed to open history database %s: %s", config.Path, err.Error()))
+	}
+
+	return &Store{
+		db:      db,
+		config:  config,
+		logger:  logger.With("component", "history"),
+		records: make(chan record, bufferSize),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Record queues status to be written, it doesn't block when database is slow
+func (s *Store) Record(key string, at time.Time, status *core.ServerStatus) {
+	sample := Sample{
+		Time:       at,
+		Online:     status.Online,
+		Players:    status.Players,
+		AvgPlayers: float64(status.Players),
+		MaxPlayers: status.MaxPlayers,
+		Map:        status.Map,
+	}
+
+	select {
+	case s.records <- record{key: key, sample: sample}:
+	default:
+		s.logger.Warn("History buffer is full, sample dropped", "server", key)
+	}
+}
+
+// Run writes queued samples and downsamples old ones until ctx is done, queued samples are written before return
+func (s *Store) Run(ctx context.Context) {
+	defer close(s.done)
+
+	s.compact(time.Now())
+
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.write(s.drain(nil, len(s.records)))
+			return
+		case r := <-s.records:
+			s.write(s.drain([]record{r}, batchSize-1))
+		case now := <-ticker.C:
+			s.compact(now)
+		}
+	}
+}
+
+// Close waits for Run to finish and closes database
+func (s *Store) Close() error {
+	<-s.done
+
+	return s.db.Close()
+}
+
+// Samples returns samples of the server in [from, to) ordered by time,
+// hourly samples are returned for the time raw samples are downsampled
+func (s *Store) Samples(ctx context.Context, key string, from time.Time, to time.Time) ([]Sample, error) {
+	rows, err := s.db.QueryContext(ctx, samplesQuery+" ORDER BY time",
+		key, from.Unix(), to.Unix(), key, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]Sample, 0)
+	for rows.Next() {
+		sample, err := scanSample(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
+
+// Peak returns the earliest sample with the most players in [from, to), nil if there are no samples
+func (s *Store) Peak(ctx context.Context, key string, from time.Time, to time.Time) (*Sample, error) {
+	row := s.db.QueryRowContext(ctx, samplesQuery+" ORDER BY players DESC, time ASC LIMIT 1",
+		key, from.Unix(), to.Unix(), key, from.Unix(), to.Unix())
+
+	sample, err := scanSample(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sample, nil
+}
+
+func (s *Store) drain(records []record, max int) []record {
+	for i := 0; i < max; i++ {
+		select {
+		case r := <-s.records:
+			records = append(records, r)
+		default:
+			return records
+		}
+	}
+
+	return records
+}
+
+func (s *Store) write(records []record) {
+	if len(records) == 0 {
+		return
+	}
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		for _, r := range records {
+			_, err := tx.Exec("INSERT INTO samples (server, time, online, players, max_players, map) VALUES (?, ?, ?, ?, ?, ?)",
+				r.key, r.sample.Time.Unix(), r.sample.Online, r.sample.Players, r.sample.MaxPlayers, r.sample.Map)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to write history samples", "error", err, "samples", len(records))
+	}
+}
+
+// compact downsamples raw samples older than raw retention to hourly ones and removes expired hourly samples.
+// Cutoff is aligned to an hour, so every hour is downsampled once.
+func (s *Store) compact(now time.Time) {
+	cutoff := now.Add(-s.config.GetRawRetention()).Truncate(time.Hour).Unix()
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO hourly_samples (server, time, online, players, avg_players, max_players)
+			SELECT server, time / 3600 * 3600, MAX(online), MAX(players), AVG(players), MAX(max_players)
+			FROM samples WHERE time < ? GROUP BY server, time / 3600`, cutoff)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM samples WHERE time < ?", cutoff)
+		if err != nil {
+			return err
+		}
+
+		if s.config.HourlyRetention > 0 {
+			expired := now.Add(-time.Duration(s.config.HourlyRetention) * 24 * time.Hour).Unix()
+
+			_, err = tx.Exec("DELETE FROM hourly_samples WHERE time < ?", expired)
+		}
+
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Failed to downsample history", "error", err)
+	}
+}
+
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSample(row scanner) (Sample, error) {
+	var sample Sample
+	var at int64
+
+	err := row.Scan(&at, &sample.Online, &sample.Players, &sample.AvgPlayers, &sample.MaxPlayers, &sample.Map)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	sample.Time = time.Unix(at, 0)
+
+	return sample, nil
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "discordmbm"
+
+var (
+	serverOnline = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "server_online",
+		Help:      "Whether server was online on the latest query, 1 - online.",
+	}, []string{"server", "game"})
+
+	serverPlayers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "server_players",
+		Help:      "Number of players on the server.",
+	}, []string{"server", "game"})
+
+	serverMaxPlayers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "server_max_players",
+		Help:      "Max number of players on the server.",
+	}, []string{"server", "game"})
+
+	serverLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "server_query_latency_seconds",
+		Help:      "Latency of the latest successful server query.",
+	}, []string{"server", "game"})
+
+	querySuccesses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "server_query_successes_total",
+		Help:      "Number of successful server queries.",
+	}, []string{"server", "game"})
+
+	queryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "server_query_failures_total",
+		Help:      "Number of failed server queries by error type.",
+	}, []string{"server", "game", "type"})
+
+	presenceUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_presence_updates_total",
+		Help:      "Number of discord bot presence updates sent.",
+	}, []string{"server"})
+
+	presenceErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_presence_update_errors_total",
+		Help:      "Number of failed discord bot presence updates.",
+	}, []string{"server"})
+
+	presenceSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_presence_updates_skipped_total",
+		Help:      "Number of discord bot presence updates skipped because presence didn't change.",
+	}, []string{"server"})
+
+	gatewayReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_gateway_reconnects_total",
+		Help:      "Number of discord gateway reconnects after the first connection.",
+	}, []string{"server"})
+
+	scpslRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scpsl_api_requests_total",
+		Help:      "Number of SCP:SL api requests by result.",
+	}, []string{"result"})
+
+	scpslRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scpsl_api_request_duration_seconds",
+		Help:      "Duration of SCP:SL api requests.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	scpslCooldown = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scpsl_api_cooldown_seconds",
+		Help:      "Cooldown reported by the latest SCP:SL api response.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		serverOnline, serverPlayers, serverMaxPlayers, serverLatency, querySuccesses, queryFailures,
+		presenceUpdates, presenceErrors, presenceSkipped, gatewayReconnects,
+		scpslRequests, scpslRequestDuration, scpslCooldown,
+	)
+}
+
+// Handler serves metrics in prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// QuerySucceeded records status of online server
+func QuerySucceeded(server string, game string, players int, maxPlayers int, latency time.Duration) {
+	serverOnline.WithLabelValues(server, game).Set(1)
+	serverPlayers.WithLabelValues(server, game).Set(float64(players))
+	serverMaxPlayers.WithLabelValues(server, game).Set(float64(maxPlayers))
+	serverLatency.WithLabelValues(server, game).Set(latency.Seconds())
+	querySuccesses.WithLabelValues(server, game).Inc()
+}
+
+// QueryFailed records offline server, errorType is one of core error types
+func QueryFailed(server string, game string, errorType string) {
+	serverOnline.WithLabelValues(server, game).Set(0)
+	serverPlayers.WithLabelValues(server, game).Set(0)
+	queryFailures.WithLabelValues(server, game, errorType).Inc()
+}
+
+// PresenceUpdated records presence update of the server bot, err is nil on success
+func PresenceUpdated(server string, err error) {
+	if err != nil {
+		presenceErrors.WithLabelValues(server).Inc()
+		return
+	}
+
+	presenceUpdates.WithLabelValues(server).Inc()
+}
+
+// PresenceSkipped records presence update not sent because bot already shows the same presence
+func PresenceSkipped(server string) {
+	presenceSkipped.WithLabelValues(server).Inc()
+}
+
+func GatewayReconnected(server string) {
+	gatewayReconnects.WithLabelValues(server).Inc()
+}
+
+// SCPSLRequested records SCP:SL api request, cooldown is taken from successful response
+func SCPSLRequested(duration time.Duration, err error, cooldown *int) {
+	scpslRequestDuration.Observe(duration.Seconds())
+
+	if err != nil {
+		scpslRequests.WithLabelValues("error").Inc()
+		return
+	}
+
+	scpslRequests.WithLabelValues("success").Inc()
+
+	if cooldown != nil {
+		scpslCooldown.Set(float64(*cooldown))
+	}
+}
+
+// DeleteServer removes series of the server stopped or removed from config
+func DeleteServer(server string) {
+	labels := prometheus.Labels{"server": server}
+
+	for _, vec := range []*prometheus.MetricVec{
+		serverOnline.MetricVec, serverPlayers.MetricVec, serverMaxPlayers.MetricVec, serverLatency.MetricVec,
+		querySuccesses.MetricVec, queryFailures.MetricVec,
+		presenceUpdates.MetricVec, presenceErrors.MetricVec, presenceSkipped.MetricVec, gatewayReconnects.MetricVec,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
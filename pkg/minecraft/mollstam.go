@@ -6,8 +6,10 @@ package minecraft
 */
 
 import (
+	"DiscordMBM/pkg/core"
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -133,18 +135,40 @@ func splitAddress(addr string) (host string, port uint16, err error) {
 	return host, uint16(u), err
 }
 
-func queryMinecraft(addr string, timeout time.Duration) (online int, players []string, err error) {
+type statusResponse struct {
+	Version struct {
+		Name string `json:"name"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+		} `json:"sample"`
+	} `json:"players"`
+}
+
+// queryMinecraft returns server list ping response with player sample names sorted
+func queryMinecraft(ctx context.Context, addr string, timeout time.Duration) (status *statusResponse, players []string, err error) {
 	host, port, err := splitAddress(addr)
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 
-	conn, err := net.DialTimeout("tcp", addr, timeout)
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 	defer conn.Close()
 
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := core.CloseOnDone(ctx, conn)
+	defer stop()
+
 	r := bufio.NewReader(conn)
 	w := bufio.NewWriter(conn)
 	buf := new(bytes.Buffer)
@@ -156,50 +180,43 @@ func queryMinecraft(addr string, timeout time.Duration) (online int, players []s
 	writeVarInt(buf, 1) // next state
 	err = writePacket(w, 0, buf.Bytes())
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 	err = w.Flush()
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 	buf.Reset()
 
 	// request
 	err = writePacket(w, 0, buf.Bytes())
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 	err = w.Flush()
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 	buf.Reset()
 
 	// response
 	id, data, err := readPacket(r)
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 	if id != 0 {
-		return 0, nil, fmt.Errorf("%w: id=%d, expected=%d", errUnexpectedPacket, id, 0)
+		return nil, nil, fmt.Errorf("%w: id=%d, expected=%d", errUnexpectedPacket, id, 0)
 	}
 	buf = bytes.NewBuffer(data)
 	s, err := readString(buf)
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 
-	var status struct {
-		Players struct {
-			Online int `json:"online"`
-			Sample []struct {
-				Name string `json:"name"`
-			} `json:"sample"`
-		} `json:"players"`
-	}
-	err = json.Unmarshal([]byte(s), &status)
+	status = new(statusResponse)
+	err = json.Unmarshal([]byte(s), status)
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, err
 	}
 
 	players = make([]string, len(status.Players.Sample))
@@ -208,5 +225,5 @@ func queryMinecraft(addr string, timeout time.Duration) (online int, players []s
 	}
 	sort.Strings(players)
 
-	return status.Players.Online, players, nil
+	return status, players, nil
 }
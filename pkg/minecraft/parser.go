@@ -3,101 +3,88 @@ package minecraft
 import (
 	"DiscordMBM/pkg/core"
 	"DiscordMBM/pkg/discord"
-	"fmt"
-	"github.com/andersfylling/disgord"
-	"log"
-	"strings"
+	"context"
+	"log/slog"
 	"time"
 )
 
 type Monitor struct {
 	Config *core.Config
+	Logger *slog.Logger
 }
 
-type ServerInfo struct {
-	Players *string `json:"Players"`
+// Info is an info section of minecraft server config
+type Info struct {
+	IP string `yaml:"ip"`
+	// MaxPlayers overrides max players reported by server if set
+	MaxPlayers int `yaml:"maxPlayers"`
 }
 
-func CreateMonitor(config *core.Config) (*Monitor, error) {
-	m := Monitor{Config: config}
-
-	return &m, nil
+func (i *Info) Address() string {
+	return i.IP
 }
 
-func (m *Monitor) Run(serverConfig core.ServerConfig) {
-	if serverConfig.RefreshDelay <= 0 {
-		log.Println(fmt.Sprintf("server %s must have valid refreshDelay property", serverConfig.Name))
-		return
-	}
+func (i *Info) Validate() []core.FieldError {
+	errs := core.ValidateAddress("ip", i.IP)
 
-	if serverConfig.Info["ip"] == nil || serverConfig.Info["maxPlayers"] == nil {
-		log.Println(fmt.Sprintf("server %s must have ip and maxPlayers properties in info section", serverConfig.Name))
-		return
+	if i.MaxPlayers < 0 {
+		errs = append(errs, core.FieldError{Field: "maxPlayers", Message: "must not be negative"})
 	}
 
-	ip := fmt.Sprintf("%s", serverConfig.Info["ip"])
+	return errs
+}
+
+func init() {
+	core.RegisterGame("mc", core.Game{
+		CreateMonitor: func(ctx context.Context, config *core.Config, logger *slog.Logger) (core.Monitor, error) {
+			return CreateMonitor(config, logger)
+		},
+		NewInfo: func() core.InfoValidator {
+			return &Info{}
+		},
+		AddressField: "ip",
+	})
+}
+
+func CreateMonitor(config *core.Config, logger *slog.Logger) (*Monitor, error) {
+	m := Monitor{Config: config, Logger: logger}
 
-	bot, err := discord.InitBot(serverConfig)
+	return &m, nil
+}
+
+func (m *Monitor) Run(ctx context.Context, poller *core.Poller) error {
+	return discord.RunServer(ctx, m.Config, poller, poller.Run)
+}
+
+func (m *Monitor) Query(ctx context.Context, serverConfig core.ServerConfig) (*core.ServerStatus, error) {
+	info := serverConfig.Info.(*Info)
+
+	srvInfo, err := m.readServerInfo(ctx, info.IP)
 	if err != nil {
-		log.Println(fmt.Sprintf("failed to set up discord bot on server %s. Details: %s", serverConfig.Name, err.Error()))
-		return
+		return nil, err
 	}
 
-	defer bot.Client.Gateway().StayConnectedUntilInterrupted()
-
-	bot.Client.Gateway().Ready(func(s disgord.Session, h *disgord.Ready) {
-		if m.Config.Logger {
-			log.Println(fmt.Sprintf("Successfully connected discord bot on server %s", serverConfig.Name))
-		}
-
-		for {
-			srvInfo, err := m.readServerInfo(ip)
-			if err != nil && m.Config.Logger {
-				log.Println(fmt.Sprintf("Error while parsing server info of %s. Details: %s", serverConfig.Name, err.Error()))
-			}
-
-			if srvInfo == nil || srvInfo.Players == nil {
-				if m.Config.Logger {
-					log.Println(fmt.Sprintf("Server %s not found, trying again in %d seconds", serverConfig.Name, serverConfig.RefreshDelay))
-				}
-
-				err := s.UpdateStatus(discord.GetServerStatusPayload(false, "0", "0", nil))
-				if err != nil {
-					log.Println(err)
-				}
-			} else {
-				*srvInfo.Players = fmt.Sprintf("%s/%d", *srvInfo.Players, serverConfig.Info["maxPlayers"])
-
-				playersInfo := strings.Split(*srvInfo.Players, "/")
-
-				if m.Config.Logger {
-					log.Println(
-						fmt.Sprintf("Server %s found and has %s/%s players",
-							serverConfig.Name, playersInfo[0], playersInfo[1]))
-				}
-
-				payload := discord.GetServerStatusPayload(true, playersInfo[0], playersInfo[1], nil)
-
-				err := s.UpdateStatus(payload)
-				if err != nil {
-					log.Println(err)
-				}
-			}
-
-			time.Sleep(time.Duration(serverConfig.RefreshDelay) * time.Second)
-		}
-	})
+	if info.MaxPlayers > 0 {
+		srvInfo.MaxPlayers = info.MaxPlayers
+	}
 
-	return
+	return srvInfo, nil
 }
 
-func (m *Monitor) readServerInfo(ip string) (*ServerInfo, error) {
-	playersNum, _, err := queryMinecraft(ip, 5*time.Second)
+func (m *Monitor) readServerInfo(ctx context.Context, ip string) (*core.ServerStatus, error) {
+	start := time.Now()
+
+	status, players, err := queryMinecraft(ctx, ip, 5*time.Second)
 	if err != nil {
 		return nil, err
 	}
 
-	players := fmt.Sprintf("%d", playersNum)
-
-	return &ServerInfo{Players: &players}, nil
+	return &core.ServerStatus{
+		Online:     true,
+		Players:    status.Players.Online,
+		MaxPlayers: status.Players.Max,
+		Version:    status.Version.Name,
+		PlayerList: players,
+		Latency:    time.Since(start),
+	}, nil
 }
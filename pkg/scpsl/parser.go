@@ -3,21 +3,30 @@ package scpsl
 import (
 	"DiscordMBM/pkg/core"
 	"DiscordMBM/pkg/discord"
+	"DiscordMBM/pkg/metrics"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/andersfylling/disgord"
 	"github.com/teivah/broadcast"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 )
 
 type Monitor struct {
 	Config *core.Config
+	Logger *slog.Logger
 	Relay  *broadcast.Relay[APIResponse]
+
+	// fetched is closed after the first api request of background loop, successful or not
+	fetched chan struct{}
+
+	mu      sync.RWMutex
+	last    *APIResponse
+	lastErr error
 }
 
 type ServerInfo struct {
@@ -32,7 +41,53 @@ type APIResponse struct {
 	Servers  []ServerInfo `json:"Servers"`
 }
 
-func CreateMonitor(config *core.Config) (*Monitor, error) {
+// Info is an info section of scp:sl server config
+type Info struct {
+	ServerID int `yaml:"serverID"`
+}
+
+func (i *Info) Validate() []core.FieldError {
+	if i.ServerID <= 0 {
+		return []core.FieldError{{Field: "serverID", Message: "server id from servers.scpslgame.com is required"}}
+	}
+
+	return nil
+}
+
+func init() {
+	core.RegisterGame("scpsl", core.Game{
+		CreateMonitor: func(ctx context.Context, config *core.Config, logger *slog.Logger) (core.Monitor, error) {
+			return CreateMonitor(ctx, config, logger)
+		},
+		NewInfo: func() core.InfoValidator {
+			return &Info{}
+		},
+		Validate: validateConfig,
+	})
+}
+
+func validateConfig(config *core.Config) []core.FieldError {
+	var errs []core.FieldError
+
+	if config.SCPSLConfig.AccountID == nil {
+		errs = append(errs, core.FieldError{Field: "scpslConfig.accountID", Message: "SCP:SL accountID is required"})
+	}
+
+	if config.SCPSLConfig.APIKey == nil || *config.SCPSLConfig.APIKey == "" {
+		errs = append(errs, core.FieldError{Field: "scpslConfig.APIKey", Message: "SCP:SL APIKey is required"})
+	}
+
+	if config.SCPSLConfig.RefreshDelay == nil || *config.SCPSLConfig.RefreshDelay <= 0 {
+		errs = append(errs, core.FieldError{
+			Field:   "scpslConfig.refreshDelay",
+			Message: "SCP:SL refreshDelay must be a positive number of seconds",
+		})
+	}
+
+	return errs
+}
+
+func CreateMonitor(ctx context.Context, config *core.Config, logger *slog.Logger) (*Monitor, error) {
 	if config.SCPSLConfig.APIKey == nil || config.SCPSLConfig.AccountID == nil || config.SCPSLConfig.RefreshDelay == nil {
 		return nil, errors.New("SCP:SL APIKey, AccountID and RefreshDelay are required")
 	}
@@ -41,143 +96,184 @@ func CreateMonitor(config *core.Config) (*Monitor, error) {
 		return nil, errors.New("invalid RefreshDelay value")
 	}
 
-	m := Monitor{Config: config}
+	m := Monitor{Config: config, Logger: logger, fetched: make(chan struct{})}
 	m.Relay = broadcast.NewRelay[APIResponse]()
 
 	go func() {
-		for {
-			err := m.parseServers()
-			if err != nil {
-				log.Println(err)
+		defer m.Relay.Close()
+
+		for first := true; ; first = false {
+			err := m.parseServers(ctx)
+			if err != nil && ctx.Err() == nil {
+				m.Logger.Error("Failed to update scp:sl servers data", "error", err)
+			}
+
+			m.mu.Lock()
+			m.lastErr = err
+			m.mu.Unlock()
+
+			if first {
+				close(m.fetched)
 			}
 
-			time.Sleep(time.Duration(*config.SCPSLConfig.RefreshDelay) * time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(*config.SCPSLConfig.RefreshDelay) * time.Second):
+			}
 		}
 	}()
 
 	return &m, nil
 }
 
-func (m *Monitor) Run(serverConfig core.ServerConfig) {
-	if serverConfig.Info["serverID"] == nil {
-		log.Println(fmt.Sprintf("server %s must have serverID property in info section", serverConfig.Name))
-		return
-	}
+func (m *Monitor) Run(ctx context.Context, poller *core.Poller) error {
+	return discord.RunServer(ctx, m.Config, poller, func(ctx context.Context) {
+		m.publish(ctx, poller)
+	})
+}
 
-	serverID, ok := serverConfig.Info["serverID"].(int)
-	if !ok {
-		log.Println(fmt.Sprintf("failed to get serverID on server %s", serverConfig.Name))
-		return
-	}
+// publish feeds poller by api responses until ctx is done, servers data is requested once for all scp:sl servers
+func (m *Monitor) publish(ctx context.Context, poller *core.Poller) {
+	l := m.Relay.Listener(1)
+	defer l.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-l.Ch():
+			if !ok {
+				return
+			}
 
-	bot, err := discord.InitBot(serverConfig)
-	if err != nil {
-		log.Println(fmt.Sprintf("failed to set up discord bot on server %s. Details: %s", serverConfig.Name, err.Error()))
-		return
+			poller.Publish(m.readServerInfo(n, poller.Config().Info.(*Info).ServerID))
+		}
 	}
+}
 
-	defer bot.Client.Gateway().StayConnectedUntilInterrupted()
+// Query returns server status from the latest scp:sl api response
+func (m *Monitor) Query(ctx context.Context, serverConfig core.ServerConfig) (*core.ServerStatus, error) {
+	serverID := serverConfig.Info.(*Info).ServerID
 
-	bot.Client.Gateway().Ready(func(s disgord.Session, h *disgord.Ready) {
-		if m.Config.Logger {
-			log.Println(fmt.Sprintf("Successfully connected discord bot on server %s", serverConfig.Name))
-		}
+	// api is polled in background for all servers, queries wait for its first request instead of repeating it
+	select {
+	case <-m.fetched:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
-		l := m.Relay.Listener(1)
-		for n := range l.Ch() {
-			srvInfo, err := m.readServerInfo(n, serverID)
-			if err != nil && m.Config.Logger {
-				log.Println(err)
-			}
+	m.mu.RLock()
+	last, lastErr := m.last, m.lastErr
+	m.mu.RUnlock()
 
-			if srvInfo == nil || srvInfo.Players == nil {
-				if m.Config.Logger {
-					log.Println(fmt.Sprintf("Server %s(%d) not found, trying again in 30 seconds", serverConfig.Name, serverID))
-				}
-
-				err := s.UpdateStatus(discord.GetServerStatusPayload(false, "0", "0", nil))
-				if err != nil {
-					log.Println(err)
-				}
-			} else {
-				if m.Config.Logger {
-					log.Println(fmt.Sprintf("Server %s found and has %s players", serverConfig.Name, *srvInfo.Players))
-				}
-
-				playersInfo := strings.Split(*srvInfo.Players, "/")
-				err := s.UpdateStatus(discord.GetServerStatusPayload(true, playersInfo[0], playersInfo[1], nil))
-				if err != nil {
-					log.Println(err)
-				}
-			}
-		}
-	})
+	if last == nil {
+		return nil, lastErr
+	}
 
-	return
+	return m.readServerInfo(*last, serverID)
 }
 
-func (m *Monitor) readServerInfo(info APIResponse, serverID int) (*ServerInfo, error) {
+func (m *Monitor) readServerInfo(info APIResponse, serverID int) (*core.ServerStatus, error) {
 	for _, v := range info.Servers {
-		if *v.ID == serverID {
-			return &v, nil
+		if v.ID == nil || *v.ID != serverID {
+			continue
 		}
+
+		if v.Players == nil {
+			return nil, errors.New(fmt.Sprintf("scp:sl api response has no players info on server %d", serverID))
+		}
+
+		// players info string is "{players}/{maxPlayers}"
+		var players, maxPlayers int
+		_, err := fmt.Sscanf(*v.Players, "%d/%d", &players, &maxPlayers)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unexpected players value %q on server %d", *v.Players, serverID))
+		}
+
+		return &core.ServerStatus{
+			Online:     true,
+			Players:    players,
+			MaxPlayers: maxPlayers,
+		}, nil
 	}
 
 	return nil, nil
 }
 
-func (m *Monitor) serverInfoRequest() ([]byte, error) {
+func (m *Monitor) serverInfoRequest(ctx context.Context) ([]byte, error) {
 	apiUrl := fmt.Sprintf("https://api.scpslgame.com/serverinfo.php?key=%s&id=%d&players=true",
 		*m.Config.SCPSLConfig.APIKey, *m.Config.SCPSLConfig.AccountID)
 
-	resp, err := http.Get(apiUrl)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
-		log.Println(fmt.Sprintf("scp:sl api request err: %s", err.Error()))
 		return nil, err
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Println(fmt.Sprintf("scp:sl api request err: %s", err.Error()))
 		return nil, err
 	}
 
 	err = resp.Body.Close()
 	if err != nil {
-		log.Println(fmt.Sprintf("scp:sl api request err: %s", err.Error()))
 		return nil, err
 	}
 
 	return data, nil
 }
 
-func (m *Monitor) parseServers() error {
-	if m.Config.Logger {
-		log.Println("Requesting scp:sl servers data")
-	}
+func (m *Monitor) parseServers(ctx context.Context) (err error) {
+	m.Logger.Debug("Requesting scp:sl servers data")
+
+	var response APIResponse
+
+	start := time.Now()
+	// panic fails only this request, background loop keeps requesting api
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("scp:sl api request panic: %v", r))
+		}
+
+		metrics.SCPSLRequested(time.Since(start), err, response.Cooldown)
+	}()
 
-	reqData, err := m.serverInfoRequest()
+	reqData, err := m.serverInfoRequest(ctx)
 	if err != nil {
-		return errors.New(fmt.Sprintf("failed to request scp:sl api. Details: %s", err.Error()))
+		return fmt.Errorf("failed to request scp:sl api. Details: %w", err)
 	}
 
-	var response APIResponse
-
 	err = json.Unmarshal(reqData, &response)
 	if err != nil {
 		return errors.New(fmt.Sprintf("failed to parse scp:sl api response. Details: %s", err.Error()))
 	}
 
-	if !*response.Success {
-		return errors.New(fmt.Sprintf("scp:sl api response status error: %s", *response.Error))
+	if response.Success == nil {
+		return errors.New("scp:sl api response has no Success field")
 	}
 
-	m.Relay.Notify(response)
+	if !*response.Success {
+		message := "no error message"
+		if response.Error != nil {
+			message = *response.Error
+		}
 
-	if m.Config.Logger {
-		log.Println("Successfully got data from scp:sl api")
+		return errors.New(fmt.Sprintf("scp:sl api response status error: %s", message))
 	}
 
+	m.mu.Lock()
+	m.last = &response
+	m.mu.Unlock()
+
+	m.Relay.NotifyCtx(ctx, response)
+
+	m.Logger.Debug("Successfully got data from scp:sl api")
+
 	return nil
 }
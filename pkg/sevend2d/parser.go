@@ -3,120 +3,106 @@ package sevend2d
 import (
 	"DiscordMBM/pkg/core"
 	"DiscordMBM/pkg/discord"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/andersfylling/disgord"
 	"github.com/gorcon/telnet"
-	"log"
+	"log/slog"
 	"regexp"
 	"strconv"
-	"strings"
 	"time"
 )
 
 type Monitor struct {
 	Config *core.Config
+	Logger *slog.Logger
 }
 
-type ServerInfo struct {
-	Players *string `json:"Players"`
+// Info is an info section of 7 days to die server config
+type Info struct {
+	TelnetIP       string `yaml:"telnetIP"`
+	TelnetPassword string `yaml:"telnetPassword"`
+	MaxPlayers     int    `yaml:"maxPlayers"`
 }
 
-func CreateMonitor(config *core.Config) (*Monitor, error) {
-	m := Monitor{Config: config}
+func (i *Info) Validate() []core.FieldError {
+	errs := core.ValidateAddress("telnetIP", i.TelnetIP)
 
-	return &m, nil
-}
-
-func (m *Monitor) Run(serverConfig core.ServerConfig) {
-	if serverConfig.RefreshDelay <= 0 {
-		log.Println(fmt.Sprintf("server %s must have valid refreshDelay property", serverConfig.Name))
-		return
+	if i.TelnetPassword == "" {
+		errs = append(errs, core.FieldError{Field: "telnetPassword", Message: "telnet password is required"})
 	}
 
-	if serverConfig.Info["telnetIP"] == nil ||
-		serverConfig.Info["telnetPassword"] == nil ||
-		serverConfig.Info["maxPlayers"] == nil {
-		log.Println(
-			fmt.Sprintf(
-				"server %s must have telnetIP, telnetPassword and maxPlayers properties in info section",
-				serverConfig.Name))
-		return
+	if i.MaxPlayers <= 0 {
+		errs = append(errs, core.FieldError{Field: "maxPlayers", Message: "must be a positive number"})
 	}
 
-	bot, err := discord.InitBot(serverConfig)
-	if err != nil {
-		log.Println(fmt.Sprintf("failed to set up discord bot on server %s. Details: %s", serverConfig.Name, err.Error()))
-		return
-	}
+	return errs
+}
 
-	defer bot.Client.Gateway().StayConnectedUntilInterrupted()
+func init() {
+	core.RegisterGame("7d2d", core.Game{
+		CreateMonitor: func(ctx context.Context, config *core.Config, logger *slog.Logger) (core.Monitor, error) {
+			return CreateMonitor(config, logger)
+		},
+		NewInfo: func() core.InfoValidator {
+			return &Info{}
+		},
+		AddressField: "telnetIP",
+	})
+}
 
-	bot.Client.Gateway().Ready(func(s disgord.Session, h *disgord.Ready) {
-		if m.Config.Logger {
-			log.Println(fmt.Sprintf("Successfully connected discord bot on server %s", serverConfig.Name))
-		}
+func CreateMonitor(config *core.Config, logger *slog.Logger) (*Monitor, error) {
+	m := Monitor{Config: config, Logger: logger}
 
-		for {
-			srvInfo, err := m.readServerInfo(serverConfig)
-			if err != nil && m.Config.Logger {
-				log.Println(err)
-			}
-
-			if srvInfo == nil || srvInfo.Players == nil {
-				if m.Config.Logger {
-					log.Println(fmt.Sprintf("Server %s not found, trying again in %d seconds", serverConfig.Name, serverConfig.RefreshDelay))
-				}
-
-				err := s.UpdateStatus(discord.GetServerStatusPayload(false, "0", "0", nil))
-				if err != nil {
-					log.Println(err)
-				}
-			} else {
-				*srvInfo.Players = fmt.Sprintf("%s/%d", *srvInfo.Players, serverConfig.Info["maxPlayers"])
-
-				playersInfo := strings.Split(*srvInfo.Players, "/")
-
-				if m.Config.Logger {
-					log.Println(
-						fmt.Sprintf("Server %s found and has %s/%s players",
-							serverConfig.Name, playersInfo[0], playersInfo[1]))
-				}
-
-				payload := discord.GetServerStatusPayload(true, playersInfo[0], playersInfo[1], nil)
-
-				err := s.UpdateStatus(payload)
-				if err != nil {
-					log.Println(err)
-				}
-			}
-
-			time.Sleep(time.Duration(serverConfig.RefreshDelay) * time.Second)
-		}
-	})
+	return &m, nil
+}
 
-	return
+func (m *Monitor) Run(ctx context.Context, poller *core.Poller) error {
+	return discord.RunServer(ctx, m.Config, poller, poller.Run)
 }
 
-func (m *Monitor) readServerInfo(serverConfig core.ServerConfig) (*ServerInfo, error) {
-	ip := fmt.Sprintf("%s", serverConfig.Info["telnetIP"])
-	password := fmt.Sprintf("%s", serverConfig.Info["telnetPassword"])
+func (m *Monitor) Query(ctx context.Context, serverConfig core.ServerConfig) (*core.ServerStatus, error) {
+	srvInfo, err := m.readServerInfo(ctx, serverConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	srvInfo.MaxPlayers = serverConfig.Info.(*Info).MaxPlayers
+
+	return srvInfo, nil
+}
 
-	conn, err := telnet.Dial(ip, password)
+func (m *Monitor) readServerInfo(ctx context.Context, serverConfig core.ServerConfig) (*core.ServerStatus, error) {
+	start := time.Now()
+
+	srvInfo := serverConfig.Info.(*Info)
+
+	conn, err := telnet.Dial(srvInfo.TelnetIP, srvInfo.TelnetPassword)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("failed to set up parser on server %s. Details: %s", serverConfig.Name, err.Error()))
+		return nil, fmt.Errorf("failed to set up parser on server %s. Details: %w", serverConfig.Name, err)
 	}
 
+	stop := core.CloseOnDone(ctx, conn)
 	info, err := conn.Execute("listplayers")
+	stop()
+
+	closeErr := conn.Close()
+
 	if err != nil {
 		return nil, err
 	}
 
+	if closeErr != nil {
+		m.Logger.Debug("Failed to close telnet connection", "name", serverConfig.Name, "error", closeErr)
+	}
+
+	playerList := parsePlayerList(info)
+
 	// info string is "{loginfo}\nTotal of 0 in the game"
 	re, _ := regexp.Compile(`Total of [0-9]+ in the game`)
 	info = string(re.Find([]byte(info)))
 
-	var players string
+	var players int
 	if info != "" {
 		re, _ := regexp.Compile(`[0-9]+`)
 		res := string(re.Find([]byte(info)))
@@ -126,15 +112,27 @@ func (m *Monitor) readServerInfo(serverConfig core.ServerConfig) (*ServerInfo, e
 			return nil, err
 		}
 
-		players = fmt.Sprintf("%d", playersNum)
+		players = int(playersNum)
 	} else {
 		return nil, errors.New(fmt.Sprintf("Unexpected telnet response. Details: %s", info))
 	}
 
-	err = conn.Close()
-	if err != nil && m.Config.Logger {
-		return nil, errors.New(fmt.Sprintf("error to close telnet connect on server %s: %s", serverConfig.Name, err.Error()))
+	return &core.ServerStatus{
+		Online:     true,
+		Players:    players,
+		PlayerList: playerList,
+		Latency:    time.Since(start),
+	}, nil
+}
+
+// playerLine matches player line of listplayers output: "0. id=171, Name, pos=(...), ..."
+var playerLine = regexp.MustCompile(`(?m)^\s*\d+\. id=\d+, (.+?), pos=`)
+
+func parsePlayerList(info string) []string {
+	var names []string
+	for _, match := range playerLine.FindAllStringSubmatch(info, -1) {
+		names = append(names, match[1])
 	}
 
-	return &ServerInfo{Players: &players}, nil
+	return names
 }
@@ -3,119 +3,120 @@ package source
 import (
 	"DiscordMBM/pkg/core"
 	"DiscordMBM/pkg/discord"
-	"fmt"
-	"github.com/andersfylling/disgord"
+	"context"
 	"github.com/rumblefrog/go-a2s"
-	"log"
-	"strings"
+	"log/slog"
+	"strconv"
 	"time"
 )
 
 type Monitor struct {
 	Config *core.Config
+	Logger *slog.Logger
 }
 
-type ServerInfo struct {
-	Players *string `json:"Players"`
+// Info is an info section of source server config
+type Info struct {
+	IP      string `yaml:"ip"`
+	MapInfo bool   `yaml:"mapInfo"`
 }
 
-func CreateMonitor(config *core.Config) (*Monitor, error) {
-	m := Monitor{Config: config}
+func (i *Info) Address() string {
+	return i.IP
+}
 
-	return &m, nil
+func (i *Info) ShowMap() bool {
+	return i.MapInfo
 }
 
-func (m *Monitor) Run(serverConfig core.ServerConfig) {
-	if serverConfig.RefreshDelay <= 0 {
-		log.Println(fmt.Sprintf("server %s must have valid refreshDelay property", serverConfig.Name))
-		return
-	}
+func (i *Info) Validate() []core.FieldError {
+	return core.ValidateAddress("ip", i.IP)
+}
 
-	if serverConfig.Info["ip"] == nil || serverConfig.Info["mapInfo"] == nil {
-		log.Println(fmt.Sprintf("server %s must have ip and mapInfo properties in info section", serverConfig.Name))
-		return
-	}
+func init() {
+	core.RegisterGame("source", core.Game{
+		CreateMonitor: func(ctx context.Context, config *core.Config, logger *slog.Logger) (core.Monitor, error) {
+			return CreateMonitor(config, logger)
+		},
+		NewInfo: func() core.InfoValidator {
+			return &Info{}
+		},
+		AddressField: "ip",
+	})
+}
 
-	ip := fmt.Sprintf("%s", serverConfig.Info["ip"])
+func CreateMonitor(config *core.Config, logger *slog.Logger) (*Monitor, error) {
+	m := Monitor{Config: config, Logger: logger}
 
-	client, err := a2s.NewClient(ip)
-	if err != nil {
-		log.Println(fmt.Sprintf(
-			"failed to set up source client on server %s. Details: %s", serverConfig.Name, err.Error()))
-		return
-	}
+	return &m, nil
+}
 
-	defer client.Close()
+func (m *Monitor) Run(ctx context.Context, poller *core.Poller) error {
+	return discord.RunServer(ctx, m.Config, poller, poller.Run)
+}
 
-	bot, err := discord.InitBot(serverConfig)
+func (m *Monitor) Query(ctx context.Context, serverConfig core.ServerConfig) (*core.ServerStatus, error) {
+	client, err := a2s.NewClient(serverConfig.Info.(*Info).IP)
 	if err != nil {
-		log.Println(fmt.Sprintf("failed to set up discord bot on server %s. Details: %s", serverConfig.Name, err.Error()))
-		return
+		return nil, err
 	}
 
-	defer bot.Client.Gateway().StayConnectedUntilInterrupted()
-
-	bot.Client.Gateway().Ready(func(s disgord.Session, h *disgord.Ready) {
-		if m.Config.Logger {
-			log.Println(fmt.Sprintf("Successfully connected discord bot on server %s", serverConfig.Name))
-		}
+	defer client.Close()
 
-		for {
-			srvInfo, err := m.readServerInfo(client)
-			if err != nil && m.Config.Logger {
-				log.Println(fmt.Sprintf("Error while parsing server %s: %s", serverConfig.Name, err.Error()))
-			}
-
-			if srvInfo == nil || srvInfo.Players == nil {
-				if m.Config.Logger {
-					log.Println(fmt.Sprintf("Server %s not found, trying again in %d seconds", serverConfig.Name, serverConfig.RefreshDelay))
-				}
-
-				err := s.UpdateStatus(discord.GetServerStatusPayload(false, "0", "0", nil))
-				if err != nil {
-					log.Println(err)
-				}
-			} else {
-				playersInfo := strings.Split(*srvInfo.Players, "/")
-
-				if m.Config.Logger {
-					log.Println(
-						fmt.Sprintf("Server %s found and has %s/%s players on map %s",
-							serverConfig.Name, playersInfo[0], playersInfo[1], playersInfo[2]))
-				}
-
-				var payload *disgord.UpdateStatusPayload
-				switch i2 := serverConfig.Info["mapInfo"].(type) {
-				case bool:
-					if i2 {
-						payload =
-							discord.GetServerStatusPayload(true, playersInfo[0], playersInfo[1], &playersInfo[2])
-					} else {
-						payload =
-							discord.GetServerStatusPayload(true, playersInfo[0], playersInfo[1], nil)
-					}
-				}
-
-				err := s.UpdateStatus(payload)
-				if err != nil {
-					log.Println(err)
-				}
-			}
-
-			time.Sleep(time.Duration(serverConfig.RefreshDelay) * time.Second)
-		}
-	})
+	stop := core.CloseOnDone(ctx, client)
+	defer stop()
 
-	return
+	return m.readServerInfo(client)
 }
 
-func (m *Monitor) readServerInfo(client *a2s.Client) (*ServerInfo, error) {
+func (m *Monitor) readServerInfo(client *a2s.Client) (*core.ServerStatus, error) {
+	start := time.Now()
+
 	info, err := client.QueryInfo()
 	if err != nil {
 		return nil, err
 	}
 
-	players := fmt.Sprintf("%d/%d/%s", info.Players, info.MaxPlayers, info.Map)
+	latency := time.Since(start)
+
+	return &core.ServerStatus{
+		Online:     true,
+		Players:    int(info.Players),
+		MaxPlayers: int(info.MaxPlayers),
+		Bots:       int(info.Bots),
+		Map:        info.Map,
+		Name:       info.Name,
+		Version:    info.Version,
+		GameMode:   info.Game,
+		PlayerList: m.readPlayers(client, int(info.Players)),
+		Latency:    latency,
+		Extra: map[string]string{
+			"folder": info.Folder,
+			"appID":  strconv.Itoa(int(info.ID)),
+		},
+	}, nil
+}
+
+// readPlayers returns names of players, nil if server doesn't answer player query.
+// Many servers disable A2S_PLAYER, so its failure doesn't make server offline.
+func (m *Monitor) readPlayers(client *a2s.Client, players int) []string {
+	if players == 0 {
+		return nil
+	}
+
+	playerInfo, err := client.QueryPlayer()
+	if err != nil {
+		m.Logger.Debug("Failed to query player list", "error", err)
+		return nil
+	}
+
+	names := make([]string, 0, len(playerInfo.Players))
+	for _, player := range playerInfo.Players {
+		// players still connecting have empty names
+		if player.Name != "" {
+			names = append(names, player.Name)
+		}
+	}
 
-	return &ServerInfo{Players: &players}, nil
+	return names
 }
@@ -3,100 +3,87 @@ package ut3
 import (
 	"DiscordMBM/pkg/core"
 	"DiscordMBM/pkg/discord"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/andersfylling/disgord"
 	"github.com/sandertv/gophertunnel/query"
-	"log"
-	"strings"
+	"log/slog"
+	"strconv"
 	"time"
 )
 
 type Monitor struct {
 	Config *core.Config
+	Logger *slog.Logger
 }
 
-type ServerInfo struct {
-	Players *string `json:"Players"`
+// Info is an info section of ut3 server config
+type Info struct {
+	IP string `yaml:"ip"`
 }
 
-func CreateMonitor(config *core.Config) (*Monitor, error) {
-	m := Monitor{Config: config}
-
-	return &m, nil
+func (i *Info) Address() string {
+	return i.IP
 }
 
-func (m *Monitor) Run(serverConfig core.ServerConfig) {
-	if serverConfig.RefreshDelay <= 0 {
-		log.Println(fmt.Sprintf("server %s must have valid refreshDelay property", serverConfig.Name))
-		return
-	}
-
-	if serverConfig.Info["ip"] == nil {
-		log.Println(fmt.Sprintf("server %s must have ip properties in info section", serverConfig.Name))
-		return
-	}
-
-	ip := fmt.Sprintf("%s", serverConfig.Info["ip"])
-
-	bot, err := discord.InitBot(serverConfig)
-	if err != nil {
-		log.Println(fmt.Sprintf("failed to set up discord bot on server %s. Details: %s", serverConfig.Name, err.Error()))
-		return
-	}
-
-	defer bot.Client.Gateway().StayConnectedUntilInterrupted()
-
-	bot.Client.Gateway().Ready(func(s disgord.Session, h *disgord.Ready) {
-		if m.Config.Logger {
-			log.Println(fmt.Sprintf("Successfully connected discord bot on server %s", serverConfig.Name))
-		}
-
-		for {
-			srvInfo, err := m.readServerInfo(ip)
-			if err != nil && m.Config.Logger {
-				log.Println(fmt.Sprintf("Error while parsing server info of %s. Details: %s", serverConfig.Name, err.Error()))
-			}
-
-			if srvInfo == nil || srvInfo.Players == nil {
-				if m.Config.Logger {
-					log.Println(fmt.Sprintf("Server %s not found, trying again in %d seconds", serverConfig.Name, serverConfig.RefreshDelay))
-				}
-
-				err := s.UpdateStatus(discord.GetServerStatusPayload(false, "0", "0", nil))
-				if err != nil {
-					log.Println(err)
-				}
-			} else {
-				playersInfo := strings.Split(*srvInfo.Players, "/")
+func (i *Info) Validate() []core.FieldError {
+	return core.ValidateAddress("ip", i.IP)
+}
 
-				if m.Config.Logger {
-					log.Println(
-						fmt.Sprintf("Server %s found and has %s/%s players",
-							serverConfig.Name, playersInfo[0], playersInfo[1]))
-				}
+func init() {
+	core.RegisterGame("ut3", core.Game{
+		CreateMonitor: func(ctx context.Context, config *core.Config, logger *slog.Logger) (core.Monitor, error) {
+			return CreateMonitor(config, logger)
+		},
+		NewInfo: func() core.InfoValidator {
+			return &Info{}
+		},
+		AddressField: "ip",
+	})
+}
 
-				payload := discord.GetServerStatusPayload(true, playersInfo[0], playersInfo[1], nil)
+func CreateMonitor(config *core.Config, logger *slog.Logger) (*Monitor, error) {
+	m := Monitor{Config: config, Logger: logger}
 
-				err := s.UpdateStatus(payload)
-				if err != nil {
-					log.Println(err)
-				}
-			}
+	return &m, nil
+}
 
-			time.Sleep(time.Duration(serverConfig.RefreshDelay) * time.Second)
-		}
-	})
+func (m *Monitor) Run(ctx context.Context, poller *core.Poller) error {
+	return discord.RunServer(ctx, m.Config, poller, poller.Run)
+}
 
-	return
+func (m *Monitor) Query(ctx context.Context, serverConfig core.ServerConfig) (*core.ServerStatus, error) {
+	// query.Do can't be interrupted, but it has its own 5 seconds deadline
+	return m.readServerInfo(serverConfig.Info.(*Info).IP)
 }
 
-func (m *Monitor) readServerInfo(ip string) (*ServerInfo, error) {
+func (m *Monitor) readServerInfo(ip string) (*core.ServerStatus, error) {
+	start := time.Now()
+
 	info, err := query.Do(ip)
 	if err != nil {
 		return nil, err
 	}
 
-	players := fmt.Sprintf("%s/%s", info["numplayers"], info["maxplayers"])
+	players, err := strconv.Atoi(info["numplayers"])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unexpected numplayers value %q", info["numplayers"]))
+	}
+
+	maxPlayers, err := strconv.Atoi(info["maxplayers"])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unexpected maxplayers value %q", info["maxplayers"]))
+	}
 
-	return &ServerInfo{Players: &players}, nil
+	return &core.ServerStatus{
+		Online:     true,
+		Players:    players,
+		MaxPlayers: maxPlayers,
+		Map:        info["mapname"],
+		Name:       info["hostname"],
+		Version:    info["version"],
+		GameMode:   info["gametype"],
+		Latency:    time.Since(start),
+		Extra:      info,
+	}, nil
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// infoFlags collects repeatable --info key=value flags
+type infoFlags map[string]string
+
+func (f infoFlags) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f infoFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return errors.New("expected key=value")
+	}
+
+	f[key] = val
+
+	return nil
+}
+
+type queryResult struct {
+	Game      string             `json:"game"`
+	Address   string             `json:"address,omitempty"`
+	Online    bool               `json:"online"`
+	LatencyMs int64              `json:"latencyMs"`
+	Status    *core.ServerStatus `json:"status,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	ErrorType string             `json:"errorType,omitempty"`
+}
+
+// query requests a single server once without discord bot, returns exit code
+func query(args []string) int {
+	info := make(infoFlags)
+
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	game := flags.String("game", "", fmt.Sprintf("game of the server, available: %s", strings.Join(core.Games(), ", ")))
+	addr := flags.String("addr", "", "server address host:port")
+	flags.Var(info, "info", "additional info section value key=value, can be repeated (e.g. telnetPassword=secret)")
+	asJSON := flags.Bool("json", false, "print result as json")
+	timeout := flags.Duration("timeout", 10*time.Second, "query timeout")
+	scpslAccountID := flags.Int("scpsl-account-id", 0, "SCP:SL account id, for scpsl game")
+	scpslAPIKey := flags.String("scpsl-api-key", "", "SCP:SL api key, for scpsl game")
+	_ = flags.Parse(args)
+
+	config := &core.Config{}
+	if *scpslAccountID != 0 {
+		config.SCPSLConfig.AccountID = scpslAccountID
+	}
+	if *scpslAPIKey != "" {
+		config.SCPSLConfig.APIKey = scpslAPIKey
+	}
+	refreshDelay := core.DefaultRefreshDelay
+	config.SCPSLConfig.RefreshDelay = &refreshDelay
+
+	gameInfo, ok := core.GetGame(*game)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown game %q, available: %s\n", *game, strings.Join(core.Games(), ", "))
+		return 2
+	}
+
+	if *addr != "" {
+		if gameInfo.AddressField == "" {
+			fmt.Fprintf(os.Stderr, "game %s servers are not queried by address, use --info instead\n", *game)
+			return 2
+		}
+
+		info[gameInfo.AddressField] = *addr
+	}
+
+	server, err := core.NewServerConfig(config, *game, *addr, info)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	result := queryResult{Game: *game, Address: *addr}
+
+	monitor, err := core.CreateMonitor(ctx, *game, config, slog.Default())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	start := time.Now()
+	status, err := monitor.Query(ctx, server)
+	elapsed := time.Since(start)
+
+	if err != nil || status == nil || !status.Online {
+		result.ErrorType = core.ClassifyError(err)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.LatencyMs = elapsed.Milliseconds()
+	} else {
+		result.Online = true
+		result.Status = status
+		result.LatencyMs = status.Latency.Milliseconds()
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printQueryResult(result)
+	}
+
+	if !result.Online {
+		return 1
+	}
+
+	return 0
+}
+
+func printQueryResult(result queryResult) {
+	fmt.Printf("game:     %s\n", result.Game)
+	if result.Address != "" {
+		fmt.Printf("address:  %s\n", result.Address)
+	}
+
+	if !result.Online {
+		fmt.Printf("status:   offline (%s)\n", result.ErrorType)
+		if result.Error != "" {
+			fmt.Printf("error:    %s\n", result.Error)
+		}
+		fmt.Printf("latency:  %dms\n", result.LatencyMs)
+
+		return
+	}
+
+	status := result.Status
+
+	fmt.Println("status:   online")
+	if status.Name != "" {
+		fmt.Printf("name:     %s\n", status.Name)
+	}
+	fmt.Printf("players:  %d/%d", status.Players, status.MaxPlayers)
+	if status.Bots > 0 {
+		fmt.Printf(" (%d bots)", status.Bots)
+	}
+	fmt.Println()
+	if status.Map != "" {
+		fmt.Printf("map:      %s\n", status.Map)
+	}
+	if status.GameMode != "" {
+		fmt.Printf("mode:     %s\n", status.GameMode)
+	}
+	if status.Version != "" {
+		fmt.Printf("version:  %s\n", status.Version)
+	}
+	if len(status.PlayerList) > 0 {
+		fmt.Printf("online:   %s\n", strings.Join(status.PlayerList, ", "))
+	}
+	fmt.Printf("latency:  %dms\n", result.LatencyMs)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"DiscordMBM/pkg/core"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// validate checks config and optionally queries every enabled server once, returns exit code
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := flags.String("config", envString("DISCORDMBM_CONFIG", "config.yml"),
+		"path to config file, env DISCORDMBM_CONFIG")
+	query := flags.Bool("query", false, "query every enabled server once to check it is reachable")
+	timeout := flags.Duration("timeout", 10*time.Second, "query timeout of a single server")
+	_ = flags.Parse(args)
+
+	config, err := core.ParseConfig(*configPath)
+	if err != nil {
+		var configErrs core.ConfigErrors
+		if !errors.As(err, &configErrs) {
+			fmt.Printf("%s: %s\n", *configPath, err.Error())
+			return 1
+		}
+
+		fmt.Printf("%s: %d issue(s) found\n", *configPath, len(configErrs))
+		for _, configErr := range configErrs {
+			fmt.Printf("  %s\n", configErr.Error())
+		}
+
+		return 1
+	}
+
+	keys := config.EnabledServers()
+	fmt.Printf("%s: ok, %d enabled server(s)\n", *configPath, len(keys))
+
+	if !*query {
+		return 0
+	}
+
+	if queryServers(config, keys, *timeout) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// queryServers queries servers concurrently and prints results, returns number of unreachable servers
+func queryServers(config *core.Config, keys []string, timeout time.Duration) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		status *core.ServerStatus
+		err    error
+	}
+
+	results := make([]result, len(keys))
+	monitors := make(map[string]core.Monitor)
+	var wg sync.WaitGroup
+
+	for i, key := range keys {
+		server := config.Servers[key]
+
+		monitor, ok := monitors[server.Game]
+		if !ok {
+			var err error
+
+			monitor, err = core.CreateMonitor(ctx, server.Game, config, slog.Default())
+			if err != nil {
+				results[i].err = err
+				continue
+			}
+
+			monitors[server.Game] = monitor
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			queryCtx, queryCancel := context.WithTimeout(ctx, timeout)
+			defer queryCancel()
+
+			results[i].status, results[i].err = monitor.Query(queryCtx, server)
+		}(i)
+	}
+
+	wg.Wait()
+
+	failed := 0
+	for i, key := range keys {
+		name := fmt.Sprintf("servers.%s (%s)", key, config.Servers[key].Name)
+		status, err := results[i].status, results[i].err
+
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("  %s: unreachable (%s): %s\n", name, core.ClassifyError(err), err.Error())
+		case status == nil || !status.Online:
+			failed++
+			fmt.Printf("  %s: not found\n", name)
+		default:
+			fmt.Printf("  %s: online, %d/%d players, %s\n",
+				name, status.Players, status.MaxPlayers, status.Latency.Round(time.Millisecond))
+		}
+	}
+
+	return failed
+}